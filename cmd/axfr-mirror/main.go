@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/tracing"
+	"git.gammaspectra.live/P2Pool/monero-highway/pkg/dnssigner"
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("git.gammaspectra.live/P2Pool/monero-highway/cmd/axfr-mirror")
+
+func transfer(primary, zone string) (rrs []dns.RR, err error) {
+	var msg dns.Msg
+	msg.SetAxfr(zone)
+	// request DNSSEC records
+	msg.SetEdns0(dns.DefaultMsgSize, true)
+
+	t := &dns.Transfer{
+		DialTimeout:  time.Second * 5,
+		ReadTimeout:  time.Second * 10,
+		WriteTimeout: time.Second * 5,
+	}
+	env, err := t.In(&msg, primary)
+	if err != nil {
+		return nil, err
+	}
+	for e := range env {
+		if e.Error != nil {
+			err = e.Error
+			// keep draining
+			continue
+		}
+		rrs = append(rrs, e.RR...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rrs, nil
+}
+
+func primarySerial(client *dns.Client, primary, zone string) (uint32, error) {
+	var msg dns.Msg
+	msg.SetQuestion(zone, dns.TypeSOA)
+	resp, _, err := client.Exchange(&msg, primary)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return 0, fmt.Errorf("primary returned code %s", dns.RcodeToString[resp.Rcode])
+	}
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("primary did not return SOA")
+}
+
+// serialNewer Whether serial a is newer than b, in serial number arithmetic. See RFC 1982, Sec 3.2
+func serialNewer(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+// fromPrimary Whether addr is an address of primary, given as host and port. See RFC 1996, Sec 3.10
+func fromPrimary(addr net.Addr, primary string) bool {
+	host, _, err := net.SplitHostPort(primary)
+	if err != nil {
+		return false
+	}
+	var remote net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		remote = a.IP
+	case *net.TCPAddr:
+		remote = a.IP
+	default:
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.Equal(remote)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		slog.Warn("Failed to resolve primary", "primary", primary, "error", err)
+		return false
+	}
+	return slices.ContainsFunc(ips, remote.Equal)
+}
+
+// Intervals used when neither the flag nor a loaded SOA sets them
+const (
+	defaultRefresh = time.Minute * 5
+	defaultRetry   = time.Minute
+)
+
+// soaInterval Returns configured if set, else the SOA field in seconds, else fallback when no SOA is loaded
+func soaInterval(zone *MirrorZone, configured, fallback time.Duration, field func(soa *dns.SOA) uint32) time.Duration {
+	if configured > 0 {
+		return configured
+	}
+	if answer := zone.Get(dns.TypeSOA); answer != nil && len(answer.RR) > 0 {
+		if soa, ok := answer.RR[0].(*dns.SOA); ok && field(soa) > 0 {
+			return time.Duration(field(soa)) * time.Second
+		}
+	}
+	return fallback
+}
+
+func main() {
+	bind := flag.String("bind", "0.0.0.0:15353", "address to bind DNS server to, UDP and TCP")
+	zoneName := flag.String("zone", "checkpoints.example.com.", "domain zone to mirror")
+	primary := flag.String("primary", "", "primary server address with port to transfer the zone from. Must allow AXFR")
+	refresh := flag.Duration("refresh", 0, "interval to check the primary for SOA changes. Default zero, use the SOA refresh value")
+	retry := flag.Duration("retry", 0, "interval to retry after a failed zone transfer. Default zero, use the SOA retry value")
+
+	axfr := flag.Bool("axfr", false, "allow zone transfers via AXFR TCP transfers from this mirror")
+	axfrMaxConcurrent := flag.Int("axfr-max-concurrent", 4, "maximum number of zone transfers served concurrently. Additional transfers are refused")
+	axfrInterval := flag.Duration("axfr-interval", time.Second, "minimum interval between zone transfers from the same client address. Set to 0 to disable")
+
+	truncation := dnssigner.DefaultTruncationPolicy()
+	udpMaxSize := flag.Uint("udp-max-size", 0, "maximum UDP response size, even if clients advertise a larger EDNS size. Larger responses are truncated. Default zero, use the client size")
+	udpAdvertiseSize := flag.Uint("udp-advertise-size", uint(truncation.AdvertiseSize), "EDNS UDP size to advertise on responses")
+	flag.BoolVar(&truncation.Minimal, "udp-minimal", truncation.Minimal, "drop additional, then authority records from UDP responses that do not fit, before truncating the answer. Dropping DNSSEC proofs sets TC")
+	flag.BoolVar(&truncation.KeepAuthority, "udp-truncated-authority", truncation.KeepAuthority, "keep authority records (SOA / NSEC) in truncated UDP responses, if they fit")
+	udp4MaxSize := flag.Uint("udp4-max-size", 0, "maximum UDP response size for IPv4 clients, overrides -udp-max-size. Default zero, use -udp-max-size")
+	udp4AdvertiseSize := flag.Uint("udp4-advertise-size", 0, "EDNS UDP size to advertise to IPv4 clients, overrides -udp-advertise-size. Default zero, use -udp-advertise-size")
+	udp6MaxSize := flag.Uint("udp6-max-size", 0, "maximum UDP response size for IPv6 clients, overrides -udp-max-size. Default zero, use -udp-max-size")
+	udp6AdvertiseSize := flag.Uint("udp6-advertise-size", 0, "EDNS UDP size to advertise to IPv6 clients, overrides -udp-advertise-size. Default zero, use -udp-advertise-size")
+	udp4Fragment := flag.String("udp4-fragment", "default", "IPv4 fragmentation of UDP responses, allowed values (default, omit-pmtu, never). Linux only")
+	udp6Fragment := flag.String("udp6-fragment", "default", "IPv6 fragmentation of UDP responses, allowed values (default, omit-pmtu, never). Linux only")
+
+	resolverBind := flag.String("resolver-bind", "", "loopback address to answer recursive queries on, UDP and TCP, for a co-located monerod. Only the zone is answered, other queries are refused. Default empty, disabled")
+	resolverUpstream := flag.String("resolver-upstream", "", "resolver (host:port, TCP) to forward DNSSEC chain of trust queries for the zone ancestors to, via -resolver-bind. Default empty, refuse them")
+
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP collector URL to export traces of zone transfers and DNS queries to, for example http://127.0.0.1:4318. Alternatively, use OTEL_EXPORTER_OTLP_ENDPOINT environment variable. Default empty, disabled")
+
+	flag.Parse()
+
+	truncation.MaxSize = uint16(min(*udpMaxSize, math.MaxUint16))
+	truncation.AdvertiseSize = uint16(min(max(*udpAdvertiseSize, dns.MinMsgSize), math.MaxUint16))
+	truncation.IPv4.MaxSize = uint16(min(*udp4MaxSize, math.MaxUint16))
+	truncation.IPv6.MaxSize = uint16(min(*udp6MaxSize, math.MaxUint16))
+	if *udp4AdvertiseSize > 0 {
+		truncation.IPv4.AdvertiseSize = uint16(min(max(*udp4AdvertiseSize, dns.MinMsgSize), math.MaxUint16))
+	}
+	if *udp6AdvertiseSize > 0 {
+		truncation.IPv6.AdvertiseSize = uint16(min(max(*udp6AdvertiseSize, dns.MinMsgSize), math.MaxUint16))
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	})))
+
+	var fragment dnssigner.FragmentPolicy
+	var err error
+	if fragment.IPv4, err = dnssigner.ParseFragmentMode(*udp4Fragment); err != nil {
+		slog.Error("Invalid -udp4-fragment", "error", err)
+		panic(err)
+	}
+	if fragment.IPv6, err = dnssigner.ParseFragmentMode(*udp6Fragment); err != nil {
+		slog.Error("Invalid -udp6-fragment", "error", err)
+		panic(err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "axfr-mirror", *otlpEndpoint)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	if *primary == "" {
+		slog.Error("-primary must be specified")
+		panic("no primary")
+	}
+
+	if !strings.HasSuffix(*zoneName, ".") {
+		slog.Warn("-zone does not end with . suffix, adding", "zone", *zoneName)
+		*zoneName += "."
+	}
+
+	zone := NewMirrorZone(*zoneName)
+
+	client := new(dns.Client)
+
+	update := func() (interval time.Duration, err error) {
+		_, span := tracer.Start(context.Background(), "axfr.refresh", trace.WithAttributes(attribute.String("dns.primary", *primary)))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+
+		serial, err := primarySerial(client, *primary, zone.Zone())
+		if err != nil {
+			return 0, err
+		}
+		span.SetAttributes(attribute.Int64("dns.serial", int64(serial)))
+
+		if current, ok := zone.Serial(); ok && !serialNewer(serial, current) {
+			if serial != current {
+				slog.Warn("Primary serial is older than the loaded zone, not transferring", "serial", serial, "current", current)
+			}
+		} else {
+			span.AddEvent("transfer")
+			rrs, err := transfer(*primary, zone.Zone())
+			if err != nil {
+				return 0, err
+			}
+			skipped, err := zone.Load(rrs)
+			if err != nil {
+				return 0, err
+			}
+			if skipped > 0 {
+				slog.Warn("Skipped records outside zone apex", "skipped", skipped)
+			}
+			var ok bool
+			if serial, ok = zone.Serial(); !ok {
+				return 0, errors.New("loaded zone has no SOA")
+			}
+			span.SetAttributes(attribute.Int("dns.records", len(rrs)))
+			slog.Info("Transferred zone", "serial", serial, "records", len(rrs))
+		}
+
+		return soaInterval(zone, *refresh, defaultRefresh, func(soa *dns.SOA) uint32 {
+			return soa.Refresh
+		}), nil
+	}
+
+	// initial transfer, keep trying until we have a zone to serve
+	interval, err := update()
+	for err != nil {
+		slog.Error("Failed initial zone transfer", "primary", *primary, "error", err)
+		time.Sleep(time.Second * 5)
+		interval, err = update()
+	}
+
+	var wg sync.WaitGroup
+	notifyChannel := make(chan struct{}, 1)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-notifyChannel:
+			case <-time.After(interval):
+			}
+			nextInterval, err := update()
+			if err != nil {
+				slog.Error("Failed zone transfer", "primary", *primary, "error", err)
+				// retry sooner
+				nextInterval = soaInterval(zone, *retry, defaultRetry, func(soa *dns.SOA) uint32 {
+					return soa.Retry
+				})
+			}
+			interval = max(nextInterval, time.Second)
+		}
+	}()
+
+	// wrap handler to answer NOTIFY from primary
+	notifyHandler := func(next dns.HandlerFunc) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, r *dns.Msg) {
+			if r.Opcode != dns.OpcodeNotify {
+				next(w, r)
+				return
+			}
+			if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA || dns.CanonicalName(r.Question[0].Name) != zone.Zone() {
+				return
+			}
+			if !fromPrimary(w.RemoteAddr(), *primary) {
+				slog.Warn("Ignoring NOTIFY from a server other than the primary", "from", w.RemoteAddr())
+				return
+			}
+			var msg dns.Msg
+			msg.SetReply(r)
+			msg.Authoritative = true
+			_ = w.WriteMsg(&msg)
+
+			slog.Debug("Received NOTIFY", "from", w.RemoteAddr())
+
+			// coalesce notifications, any pending check will pick this up
+			select {
+			case notifyChannel <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	serveOpts := dnssigner.DefaultServeOptions()
+	serveOpts.AXFR = *axfr
+	serveOpts.Transfers = dnssigner.NewTransferLimiter(*axfrMaxConcurrent, *axfrInterval)
+	serveOpts.Truncation = truncation
+	serveOpts.Fragment = fragment
+	serveOpts.Wrap = notifyHandler
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		slog.Info("Starting DNS server on UDP and TCP", "bind", *bind)
+		if err := dnssigner.Serve(context.Background(), zone, *bind, serveOpts); err != nil {
+			slog.Error("Failed to start DNS server", "bind", *bind, "error", err)
+		}
+	}()
+
+	if *resolverBind != "" {
+		if host, _, err := net.SplitHostPort(*resolverBind); err != nil || !net.ParseIP(host).IsLoopback() {
+			slog.Warn("-resolver-bind is not a loopback address, queries from other addresses are refused", "bind", *resolverBind)
+		}
+
+		resolverOpts := serveOpts
+		resolverOpts.AXFR = false
+		resolverOpts.Wrap = dnssigner.NewResolver(zone, *resolverUpstream, time.Second*5).Wrap
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slog.Info("Starting resolver on UDP and TCP", "bind", *resolverBind, "upstream", *resolverUpstream)
+			if err := dnssigner.Serve(context.Background(), zone, *resolverBind, resolverOpts); err != nil {
+				slog.Error("Failed to start resolver", "bind", *resolverBind, "error", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	slog.Error("Exiting, no active servers")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"git.gammaspectra.live/P2Pool/monero-highway/pkg/dnssigner"
+	"github.com/miekg/dns"
+)
+
+// MirrorZone Holds a pre-signed copy of a zone received via zone transfer
+type MirrorZone struct {
+	zone       string
+	zoneLabels []string
+
+	snapshot atomic.Pointer[dnssigner.ZoneData]
+}
+
+func NewMirrorZone(zone string) *MirrorZone {
+	return &MirrorZone{
+		zone:       dns.CanonicalName(zone),
+		zoneLabels: dns.SplitDomainName(zone),
+	}
+}
+
+type mirrorKey struct {
+	name  string
+	rtype uint16
+}
+
+// Load Replaces the zone contents with the records of a full zone transfer. Records outside the zone are skipped.
+// RRsets are kept with their signatures, if any, so unsigned zones are mirrored as-is and answered without proofs
+func (z *MirrorZone) Load(rrs []dns.RR) (skipped int, err error) {
+	sets := make(map[mirrorKey]*dnssigner.SignedAnswer)
+	var keys []mirrorKey
+	sigs := make(map[mirrorKey]*dns.RRSIG)
+	var soa *dns.SOA
+
+	for _, rr := range rrs {
+		name := dns.CanonicalName(rr.Header().Name)
+		if rr.Header().Class != dns.ClassINET || !dns.IsSubDomain(z.zone, name) {
+			skipped++
+			continue
+		}
+		switch r := rr.(type) {
+		case *dns.RRSIG:
+			sigs[mirrorKey{name: name, rtype: r.TypeCovered}] = r
+			continue
+		case *dns.SOA:
+			// transfers start and end with SOA
+			if name != z.zone || soa != nil {
+				continue
+			}
+			soa = r
+		}
+
+		key := mirrorKey{name: name, rtype: rr.Header().Rrtype}
+		answer, ok := sets[key]
+		if !ok {
+			answer = &dnssigner.SignedAnswer{}
+			sets[key] = answer
+			keys = append(keys, key)
+		}
+		answer.RR = append(answer.RR, rr)
+	}
+
+	if soa == nil {
+		return skipped, errors.New("zone transfer did not include SOA")
+	}
+
+	data := dnssigner.NewZoneData(z.zone)
+	for _, key := range keys {
+		answer := sets[key]
+		answer.Sig = sigs[key]
+		data = data.With(key.name, key.rtype, answer)
+	}
+
+	z.snapshot.Store(data)
+	return skipped, nil
+}
+
+// Serial Returns the SOA serial of the loaded zone, or false if none has been loaded yet
+func (z *MirrorZone) Serial() (uint32, bool) {
+	soa := z.Get(dns.TypeSOA)
+	if soa == nil {
+		return 0, false
+	}
+	return soa.RR[0].(*dns.SOA).Serial, true
+}
+
+func (z *MirrorZone) Zone() string {
+	return z.zone
+}
+
+func (z *MirrorZone) ZoneLabels() []string {
+	return z.zoneLabels
+}
+
+// Get Returns the RRset of rtype at the zone apex
+func (z *MirrorZone) Get(rtype uint16) *dnssigner.SignedAnswer {
+	snapshot := z.snapshot.Load()
+	if snapshot == nil {
+		return nil
+	}
+	return snapshot.Get(z.zone, rtype)
+}
+
+func (z *MirrorZone) Snapshot() *dnssigner.ZoneData {
+	return z.snapshot.Load()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v4/monero/client/rpc"
+	"git.gammaspectra.live/P2Pool/consensus/v4/monero/client/rpc/daemon"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var daemonMetrics = expvar.NewMap("daemons")
+
+// unhealthyErrors Consecutive errors after which a backend is only used as last resort
+const unhealthyErrors = 3
+
+// unhealthyCooldown Time after the last error after which an unhealthy backend is considered again
+const unhealthyCooldown = time.Second * 30
+
+// latencyWeight Weight of new samples on the moving average latency
+const latencyWeight = 0.2
+
+// DaemonBackend A single monerod RPC endpoint with response statistics
+type DaemonBackend struct {
+	url        string
+	httpClient *http.Client
+	rpc        *rpc.Client
+	daemon     *daemon.Client
+
+	lock              sync.Mutex
+	latency           float64
+	requests          uint64
+	errors            uint64
+	consecutiveErrors uint64
+	lastError         time.Time
+	capabilities      *DaemonCapabilities
+}
+
+type DaemonBackendStats struct {
+	Url               string        `json:"url"`
+	Latency           time.Duration `json:"latency"`
+	Requests          uint64        `json:"requests"`
+	Errors            uint64        `json:"errors"`
+	ConsecutiveErrors uint64        `json:"consecutive_errors"`
+	Healthy           bool          `json:"healthy"`
+
+	Capabilities *DaemonCapabilities `json:"capabilities,omitempty"`
+}
+
+func NewDaemonBackend(rpcUrl string, client *http.Client) (*DaemonBackend, error) {
+	rpcServer, err := rpc.NewClient(rpcUrl, rpc.WithHTTPClient(client))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &DaemonBackend{
+		url:        rpcUrl,
+		httpClient: client,
+		rpc:        rpcServer,
+		daemon:     daemon.NewClient(rpcServer),
+	}
+	daemonMetrics.Set(rpcUrl, expvar.Func(func() any {
+		return b.Stats()
+	}))
+	return b, nil
+}
+
+func (b *DaemonBackend) record(latency time.Duration, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.requests++
+	if err != nil {
+		b.errors++
+		b.consecutiveErrors++
+		b.lastError = time.Now()
+		return
+	}
+	b.consecutiveErrors = 0
+	if b.latency == 0 {
+		b.latency = float64(latency)
+	} else {
+		b.latency = b.latency*(1-latencyWeight) + float64(latency)*latencyWeight
+	}
+}
+
+func (b *DaemonBackend) healthy() bool {
+	return b.consecutiveErrors < unhealthyErrors || time.Since(b.lastError) >= unhealthyCooldown
+}
+
+func (b *DaemonBackend) Stats() DaemonBackendStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return DaemonBackendStats{
+		Url:               b.url,
+		Latency:           time.Duration(b.latency),
+		Requests:          b.requests,
+		Errors:            b.errors,
+		ConsecutiveErrors: b.consecutiveErrors,
+		Healthy:           b.healthy(),
+		Capabilities:      b.capabilities,
+	}
+}
+
+// ordered Returns backends sorted by preference: healthy first, then by lowest latency
+func (d *Daemon) ordered() []*DaemonBackend {
+	if len(d.backends) == 1 {
+		return d.backends
+	}
+	stats := make(map[*DaemonBackend]DaemonBackendStats, len(d.backends))
+	for _, b := range d.backends {
+		stats[b] = b.Stats()
+	}
+	return slices.SortedStableFunc(slices.Values(d.backends), func(a, b *DaemonBackend) int {
+		sa, sb := stats[a], stats[b]
+		if sa.Healthy != sb.Healthy {
+			if sa.Healthy {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(sa.Latency, sb.Latency)
+	})
+}
+
+// call Runs f against the preferred backend, falling back to the next ones on error
+func (d *Daemon) call(ctx context.Context, method string, f func(ctx context.Context, b *DaemonBackend) error) (err error) {
+	for _, b := range d.ordered() {
+		if err = d.attempt(ctx, method, b, f); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// callEach Runs f against all healthy backends concurrently, or all backends if none is healthy.
+// Returns the joined errors if every backend failed
+func (d *Daemon) callEach(ctx context.Context, method string, f func(ctx context.Context, b *DaemonBackend) error) error {
+	backends := slices.DeleteFunc(d.ordered(), func(b *DaemonBackend) bool {
+		return !b.Stats().Healthy
+	})
+	if len(backends) == 0 {
+		backends = d.backends
+	}
+
+	errs := make([]error, len(backends))
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = d.attempt(ctx, method, b, f)
+		}()
+	}
+	wg.Wait()
+
+	if slices.Contains(errs, nil) {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// attempt Runs f against backend b, traced as a span of method
+func (d *Daemon) attempt(ctx context.Context, method string, b *DaemonBackend, f func(ctx context.Context, b *DaemonBackend) error) error {
+	<-d.rateLimit.C
+	ctx, span := tracer.Start(ctx, "monerod."+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("rpc.method", method),
+		attribute.String("server.url", b.url),
+	))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := f(ctx, b)
+	b.record(time.Since(start), err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Probe Measures latency of all backends, so idle ones are considered again once they recover
+func (d *Daemon) Probe() {
+	for _, b := range d.backends {
+		<-d.rateLimit.C
+		func() {
+			ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+			defer cancel()
+
+			start := time.Now()
+			_, err := b.daemon.GetLastBlockHeader(ctx)
+			b.record(time.Since(start), err)
+		}()
+	}
+}
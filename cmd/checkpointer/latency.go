@@ -0,0 +1,71 @@
+package main
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+var publishMetrics = expvar.NewMap("publish")
+
+// PublishStats End-to-end latency from a block reaching checkpoint depth to its record being live on a target
+type PublishStats struct {
+	LastLatency    time.Duration `json:"last_latency"`
+	AverageLatency time.Duration `json:"average_latency"`
+	MaxLatency     time.Duration `json:"max_latency"`
+	Publishes      uint64        `json:"publishes"`
+	Errors         uint64        `json:"errors"`
+	LastPublish    time.Time     `json:"last_publish,omitzero"`
+}
+
+type LatencyTracker struct {
+	lock    sync.Mutex
+	targets map[string]*PublishStats
+}
+
+func NewLatencyTracker() *LatencyTracker {
+	return &LatencyTracker{
+		targets: make(map[string]*PublishStats),
+	}
+}
+
+func (t *LatencyTracker) stats(target string) *PublishStats {
+	stats, ok := t.targets[target]
+	if !ok {
+		stats = &PublishStats{}
+		t.targets[target] = stats
+		publishMetrics.Set(target, expvar.Func(func() any {
+			return t.Stats(target)
+		}))
+	}
+	return stats
+}
+
+// Record Records a publish attempt to target, for a block that reached checkpoint depth at depthReachedAt
+func (t *LatencyTracker) Record(target string, depthReachedAt time.Time, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	stats := t.stats(target)
+	if err != nil {
+		stats.Errors++
+		return
+	}
+
+	now := time.Now()
+	latency := now.Sub(depthReachedAt)
+	stats.LastLatency = latency
+	stats.MaxLatency = max(stats.MaxLatency, latency)
+	stats.AverageLatency = (stats.AverageLatency*time.Duration(stats.Publishes) + latency) / time.Duration(stats.Publishes+1)
+	stats.Publishes++
+	stats.LastPublish = now
+}
+
+func (t *LatencyTracker) Stats(target string) PublishStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if stats, ok := t.targets[target]; ok {
+		return *stats
+	}
+	return PublishStats{}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/highway/checkpoint"
+)
+
+// errStandby Returned instead of publishing while another checkpointer holds the publisher lease
+var errStandby = errors.New("standby, publisher lease is held by another checkpointer")
+
+// LeaseKeeper Holds the publisher lease of a dns-checkpoints api while possible, so only one of several
+// redundant checkpointers publishes. The others stay on standby and verify the published records instead
+type LeaseKeeper struct {
+	client *checkpoint.HighwayClient
+	holder string
+	ttl    time.Duration
+
+	// expires Local time the lease is known to be held until, in unix nanoseconds
+	expires atomic.Int64
+
+	onAcquire []func()
+}
+
+func NewLeaseKeeper(client *checkpoint.HighwayClient, holder string, ttl time.Duration) *LeaseKeeper {
+	return &LeaseKeeper{
+		client: client,
+		holder: holder,
+		ttl:    ttl,
+	}
+}
+
+func (k *LeaseKeeper) Holder() string {
+	return k.holder
+}
+
+// OnAcquire Registers f to be called each time the lease is acquired after not being held. Must be called before Run
+func (k *LeaseKeeper) OnAcquire(f func()) {
+	k.onAcquire = append(k.onAcquire, f)
+}
+
+// Leader Whether the lease is held. Leadership is given up locally when the lease expires without renewal
+func (k *LeaseKeeper) Leader() bool {
+	return time.Now().UnixNano() < k.expires.Load()
+}
+
+// Run Acquires and renews the lease every third of the granted ttl until ctx is cancelled, then releases it
+func (k *LeaseKeeper) Run(ctx context.Context) {
+	interval := k.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// measured before the request, so the local view never outlasts the server lease
+		start := time.Now()
+		wasLeader := k.Leader()
+		lease, err := func() (checkpoint.HighwayLease, error) {
+			ctx, cancel := context.WithTimeout(ctx, interval)
+			defer cancel()
+			return k.client.AcquireLease(ctx, k.holder, k.ttl)
+		}()
+		if err == nil {
+			// the server caps the ttl, leadership must not outlast what was granted
+			granted := k.ttl
+			if lease.TTL > 0 {
+				granted = min(granted, time.Duration(lease.TTL)*time.Second)
+			}
+			k.expires.Store(start.Add(granted).UnixNano())
+			if granted/3 != interval {
+				if granted < k.ttl {
+					slog.Warn("Publisher lease granted for less than -lease-ttl", "holder", k.holder, "ttl", k.ttl, "granted", granted)
+				}
+				interval = granted / 3
+				ticker.Reset(interval)
+			}
+			if !wasLeader {
+				slog.Info("Acquired publisher lease, publishing", "holder", k.holder, "term", lease.Term)
+				for _, f := range k.onAcquire {
+					f()
+				}
+			}
+		} else if checkpoint.IsLeaseHeld(err) {
+			k.expires.Store(0)
+			if wasLeader {
+				slog.Warn("Lost publisher lease, on standby", "holder", k.holder, "error", err)
+			} else {
+				slog.Debug("Publisher lease is held by another checkpointer, on standby", "error", err)
+			}
+		} else if ctx.Err() == nil {
+			slog.Warn("Error renewing publisher lease", "holder", k.holder, "leader", k.Leader(), "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if k.Leader() {
+				k.expires.Store(0)
+				releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+				if err := k.client.ReleaseLease(releaseCtx, k.holder); err != nil {
+					slog.Warn("Error releasing publisher lease", "holder", k.holder, "error", err)
+				} else {
+					slog.Info("Released publisher lease", "holder", k.holder)
+				}
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Verify Waits until the records published by the leader include checkpoint c, or ctx is done
+func (k *LeaseKeeper) Verify(ctx context.Context, c checkpoint.Checkpoint) error {
+	for {
+		records, err := k.client.Records(ctx)
+		if err == nil {
+			if slices.ContainsFunc(records, func(r checkpoint.HighwayRecord) bool {
+				parsed, err := checkpoint.ParseMoneroRecord(r.Txt)
+				return err == nil && parsed == c
+			}) {
+				return nil
+			}
+			err = fmt.Errorf("checkpoint %s is not published", c)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Second * 5):
+		}
+	}
+}
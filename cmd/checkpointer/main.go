@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -12,36 +13,99 @@ import (
 	"net/http"
 	"os"
 	"slices"
+	"sync"
 	"time"
 
 	"git.gammaspectra.live/P2Pool/consensus/v4/monero/client/zmq"
 	"git.gammaspectra.live/P2Pool/consensus/v4/types"
 	"git.gammaspectra.live/P2Pool/monero-highway/internal/highway/checkpoint"
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/migrate"
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/tracing"
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/utils"
 	"github.com/goccy/go-yaml"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
-type MoneroCheckpoints struct {
-	Hashlines []MoneroCheckpoint `json:"hashlines,omitempty"`
-}
-
-type MoneroCheckpoint struct {
-	Hash   types.Hash `json:"hash"`
-	Height uint64     `json:"height"`
-}
+var tracer = otel.Tracer("git.gammaspectra.live/P2Pool/monero-highway/cmd/checkpointer")
 
 func main() {
-	rpcUrl := flag.String("rpc", "http://127.0.0.1:18081", "Monero RPC server URL. Can be restricted")
-	zmqAddr := flag.String("zmq", "tcp://127.0.0.1:18083", "Monero ZMQ-PUB server address")
+	rpcUrls := utils.ListFlag{Validate: utils.ValidateURL}
+	flag.Var(&rpcUrls, "rpc", "Monero RPC server URL. Can be restricted. Can be specified multiple times or comma separated, requests will be routed to the fastest healthy server, the tip is taken from the server with the most cumulative difficulty (default http://127.0.0.1:18081)")
+	zmqAddrs := utils.ListFlag{Validate: utils.ValidateURL}
+	flag.Var(&zmqAddrs, "zmq", "Monero ZMQ-PUB server address. Can be specified multiple times or comma separated, notifications are deduplicated across all of them (default tcp://127.0.0.1:18083)")
 
 	doLoop := flag.Bool("loop", false, "By default the program will bail out when a sanity check fails or miscondition happens. Enable this to make it loop instead from scratch")
 	pushConfigPath := flag.String("push-config", "", "Path to YAML file to push records")
+	pushTimeout := flag.Duration("push-timeout", time.Second*30, "Deadline for pushing records to each target, including retries and read-back verification")
 	checkpointStatePath := flag.String("checkpoint-state", "checkpoints.json", "File where to save checkpoints.json state. Directory where it is emplaced must be writable and on same mount. Same format as used in Monero, point this to the .bitmonero folder or .bitmonero/testnet for loading the checkpoints faster.")
 	checkpointDepth := flag.Uint64("checkpoint-depth", 2, "Depth from tip to place checkpoints at. Depth of 2, means tip height of 100 will checkpoint 98")
+	checkpointHistory := flag.Int("checkpoint-history", 1, "Number of most recent checkpoints to keep in state and push to targets. Transforms in -push-config select which of them each target publishes")
 	checkpointInterval := flag.Duration("checkpoint-interval", 0, "Interval when checkpoints will be set. Default zero, checkpoint instantly. Recommended: 5m")
 
+	altBlockPolicy := flag.String("alt-block-policy", "ignore", "What to do when an alternative block exists at or above the checkpoint height. Allowed values (ignore, depth, delay). depth increases depth by -alt-block-extra-depth, delay waits for the next tip. Unless ignore, a failed lookup of alternative blocks also waits for the next tip")
+	altBlockExtraDepth := flag.Uint64("alt-block-extra-depth", 2, "Extra depth to add to -checkpoint-depth when -alt-block-policy is depth")
+
+	verifyRpcUrls := utils.ListFlag{Validate: utils.ValidateURL}
+	flag.Var(&verifyRpcUrls, "verify-rpc", "Additional Monero RPC server URL to verify checkpoints against. On disagreement, enter safe mode and stop publishing. Can be specified multiple times or comma separated")
+	verifyObserver := flag.String("verify-p2pool-observer", "", "P2Pool observer API URL to verify checkpoints against, with a %d placeholder for the height. Must return the main chain block with id and height fields. Example: https://p2pool.observer/api/main_block_by/%d")
+	safeModeTimeout := flag.Duration("safe-mode-timeout", 0, "Time after which safe mode is left automatically. Default zero, stay in safe mode until SIGUSR1 is received")
+
+	leaseUrl := flag.String("lease-url", "", "dns-checkpoints HTTP API URL to hold the publisher lease on. When several checkpointers share it, only the lease holder publishes, the others verify the published records. Default empty, always publish")
+	leaseToken := flag.String("lease-token", os.Getenv("MONERO_HIGHWAY_API_TOKEN"), "bearer token for -lease-url. Alternatively, use MONERO_HIGHWAY_API_TOKEN environment variable")
+	leaseHolder := flag.String("lease-holder", "", "unique name of this checkpointer for the publisher lease. Default hostname and process id")
+	leaseTTL := flag.Duration("lease-ttl", time.Second*30, "duration of the publisher lease, renewed every third of it. A standby takes over after the leader fails to renew within it")
+	metricsBind := flag.String("metrics-bind", "", "Address to bind an HTTP server exposing metrics under /debug/vars. Default disabled")
+	checkMigrations := flag.Bool("check-migrations", false, "report the version of -checkpoint-state and the migrations it needs, then exit without writing. Exits with status 1 if it cannot be migrated. Older versions are migrated automatically on startup")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP collector URL to export traces of tip checks, monerod RPC calls and pushes to, for example http://127.0.0.1:4318. Trace context is sent along pushes to dns-checkpoints. Alternatively, use OTEL_EXPORTER_OTLP_ENDPOINT environment variable. Default empty, disabled")
+
 	flag.Parse()
 
+	if *checkMigrations {
+		if *checkpointStatePath != "" && !checkpointStateSchema.Report(*checkpointStatePath) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "checkpointer", *otlpEndpoint)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	if len(rpcUrls.Values) == 0 {
+		rpcUrls.Values = append(rpcUrls.Values, "http://127.0.0.1:18081")
+	}
+	if len(zmqAddrs.Values) == 0 {
+		zmqAddrs.Values = append(zmqAddrs.Values, "tcp://127.0.0.1:18083")
+	}
+
+	if *metricsBind != "" {
+		go func() {
+			slog.Info("Starting metrics HTTP server", "bind", *metricsBind)
+			// expvar registers on default mux
+			if err := http.ListenAndServe(*metricsBind, nil); err != nil {
+				slog.Error("Failed to start metrics HTTP server", "bind", *metricsBind, "error", err)
+			}
+		}()
+	}
+
+	switch *altBlockPolicy {
+	case "ignore", "depth", "delay":
+	default:
+		slog.Error("Unknown alt block policy", "policy", *altBlockPolicy)
+		panic("unknown alt block policy")
+	}
+
+	breaker := NewCircuitBreaker(*safeModeTimeout)
+	latencyTracker := NewLatencyTracker()
+	resetOnSignal(breaker)
+
 	for {
 		func() {
 			if *doLoop {
@@ -77,29 +141,73 @@ func main() {
 					slog.Error("Failed to parse push config", "err", err)
 					panic(err)
 				}
+				for i, c := range checkpointers {
+					if err = c.Validate(); err != nil {
+						slog.Error("Invalid push config", "target", c.Id(i), "err", err)
+						panic(err)
+					}
+				}
 				slog.Info(fmt.Sprintf("Loaded push config with %d entries", len(checkpointers)))
 			}
 
-			monerod, err := NewDaemon(*rpcUrl, httpClient, time.Second*30)
+			monerod, err := NewDaemon(rpcUrls.Values, httpClient, time.Second*30)
 			if err != nil {
 				slog.Error("Error creating monero client", "error", err)
 				panic(err)
 			}
+			if err = monerod.DetectCapabilities(*altBlockPolicy != "ignore"); err != nil {
+				slog.Error("Missing monerod capabilities", "error", err)
+				panic(err)
+			}
+
+			var verifiers []Verifier
+			for _, u := range verifyRpcUrls.Values {
+				d, err := NewDaemon([]string{u}, httpClient, time.Second*30)
+				if err != nil {
+					slog.Error("Error creating monero verification client", "rpc", u, "error", err)
+					panic(err)
+				}
+				if err = d.DetectCapabilities(false); err != nil {
+					slog.Error("Missing monerod verification capabilities", "rpc", u, "error", err)
+					panic(err)
+				}
+				if d.NetType() != monerod.NetType() {
+					slog.Error("Verification monerod is on a different network", "rpc", u, "nettype", d.NetType(), "expected", monerod.NetType())
+					panic("verification network mismatch")
+				}
+				verifiers = append(verifiers, NewDaemonVerifier(u, d))
+			}
+			if *verifyObserver != "" {
+				verifiers = append(verifiers, NewObserverVerifier(*verifyObserver, httpClient, time.Second*30))
+			}
 
 			var check checkpoint.Checkpoint
+			// history Most recent checkpoints, highest first, including check
+			var history checkpoint.Checkpoints
 			//TODO: get from DNS?
 
+			var checkpointState MoneroCheckpoints
+
 			if *checkpointStatePath != "" {
-				stateData, err := os.ReadFile(*checkpointStatePath)
+				stateData, from, err := checkpointStateSchema.File(*checkpointStatePath)
+				if errors.Is(err, migrate.ErrNewerVersion) {
+					// saving would stamp the newer version on fields it does not know about
+					slog.Error("State file was written by a newer version, refusing to start", "path", *checkpointStatePath, "version", from, "supported", CheckpointStateVersion)
+					panic(err)
+				} else if err == nil && from < CheckpointStateVersion {
+					slog.Info("Migrated state file", "from", from, "to", CheckpointStateVersion, "backup", migrate.BackupPath(*checkpointStatePath, from))
+				}
 				if err != nil {
 					slog.Error("Error reading state file", "error", err)
 				} else {
-					var checkpointState MoneroCheckpoints
 					// we can continue - no state exists yet
 					err = json.Unmarshal(stateData, &checkpointState)
 					if err != nil {
 						slog.Error("Error parsing state file", "error", err)
-					} else if len(checkpointState.Hashlines) > 0 {
+						checkpointState = MoneroCheckpoints{}
+					}
+
+					if err == nil && len(checkpointState.Hashlines) > 0 {
 						// DESC
 						slices.SortFunc(checkpointState.Hashlines, func(a, b MoneroCheckpoint) int {
 							return int(b.Height) - int(a.Height)
@@ -108,24 +216,151 @@ func main() {
 						check.Height = checkpointState.Hashlines[0].Height
 						check.Id = checkpointState.Hashlines[0].Hash
 
+						for _, h := range checkpointState.Hashlines[:min(len(checkpointState.Hashlines), max(1, *checkpointHistory))] {
+							history = append(history, checkpoint.Checkpoint{
+								Height: h.Height,
+								Id:     h.Hash,
+							})
+						}
+
 						slog.Info("Loaded checkpoint from state file", "height", check.Height, "id", check.Id)
 					}
 				}
 			}
 
+			// without notifications, poll the tip more often
+			fallbackInterval := time.Second * 5
+			for _, zmqAddr := range zmqAddrs.Values {
+				if err := probeZMQ(zmqAddr, time.Second*5); err != nil {
+					slog.Warn("Could not connect to monerod ZMQ-PUB", "zmq", zmqAddr, "error", err)
+				} else {
+					fallbackInterval = time.Second * 30
+				}
+			}
+			if fallbackInterval < time.Second*30 {
+				slog.Warn("No ZMQ-PUB reachable, polling tip instead", "interval", fallbackInterval)
+			}
+
 			type NotifyHeader struct {
 				Height     uint64
 				Id         types.Hash
 				PreviousId types.Hash
 			}
 
-			tipNotifier := make(chan NotifyHeader, 10)
+			// notifications only wake up the tip check, older ones can be dropped if it falls behind
+			tipNotifier := NewDropQueue[NotifyHeader]("tip_notifier", 10)
 
 			closeCtx, closeCancel := context.WithCancel(context.Background())
 			defer closeCancel()
 
 			var wg errgroup.Group
-			wg.Go(func() error {
+
+			// stateLock Guards checkpointState, written by the checkpoint loop and by each target after publishing
+			var stateLock sync.Mutex
+
+			var lease *LeaseKeeper
+			if *leaseUrl != "" {
+				client, err := checkpoint.NewHighwayClient(dialer, *leaseUrl, *leaseToken)
+				if err != nil {
+					slog.Error("Invalid -lease-url", "error", err)
+					panic(err)
+				}
+				holder := *leaseHolder
+				if holder == "" {
+					hostname, _ := os.Hostname()
+					holder = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+				}
+				lease = NewLeaseKeeper(client, holder, max(*leaseTTL, time.Second*3))
+			}
+
+			var schedulers []*TargetScheduler
+			for i, c := range checkpointers {
+				s := NewTargetScheduler(i, c, checkpointState.Targets[c.Id(i)].LastPublish)
+				schedulers = append(schedulers, s)
+
+				wg.Go(func() error {
+					s.Run(closeCtx, func(job PublishJob) (err error) {
+						check := job.History[0]
+						ctx, span := tracer.Start(trace.ContextWithSpanContext(closeCtx, job.Trace), "checkpointer.publish", trace.WithAttributes(
+							attribute.String("checkpointer.target", c.Id(i)),
+							attribute.Int64("checkpoint.height", int64(check.Height)),
+						))
+						defer func() {
+							if err != nil && !errors.Is(err, errStandby) {
+								span.RecordError(err)
+								span.SetStatus(codes.Error, err.Error())
+							}
+							span.End()
+						}()
+
+						if lease != nil && !lease.Leader() {
+							slog.Debug("Not sending checkpoint on standby", "index", i, "name", c.Id(i), "height", check.Height)
+							span.SetAttributes(attribute.Bool("checkpointer.standby", true))
+							return errStandby
+						}
+
+						err = func() error {
+							// cancelled on shutdown as well
+							ctx, cancel := context.WithTimeout(ctx, *pushTimeout)
+							defer cancel()
+							for {
+								var holder string
+								if lease != nil {
+									holder = lease.Holder()
+								}
+								err := c.Send(dialer, ctx, job.History, holder)
+								if err == nil || checkpoint.IsPermanent(err) {
+									return err
+								}
+								slog.Warn("Error sending checkpoint, retrying", "index", i, "error", err)
+								select {
+								case <-ctx.Done():
+									return err
+								case <-time.After(time.Second * 5):
+								}
+							}
+						}()
+						latencyTracker.Record(c.Id(i), job.DepthReachedAt, err)
+						if err != nil {
+							slog.Error("Error sending checkpoint", "index", i, "name", c.Id(i), "error", err)
+							// errors are fine here
+							return err
+						}
+						slog.Info("Sent checkpoint", "index", i, "name", c.Id(i), "height", check.Height, "latency", latencyTracker.Stats(c.Id(i)).LastLatency)
+
+						stateLock.Lock()
+						defer stateLock.Unlock()
+						if checkpointState.Targets == nil {
+							checkpointState.Targets = make(map[string]TargetState)
+						}
+						checkpointState.Targets[c.Id(i)] = TargetState{
+							LastPublish: time.Now().UTC(),
+							Height:      check.Height,
+							Hash:        check.Id,
+						}
+						if *checkpointStatePath != "" {
+							if err := checkpointState.Save(*checkpointStatePath); err != nil {
+								slog.Error("Error writing checkpoint file", "error", err)
+							}
+						}
+						return nil
+					})
+					return nil
+				})
+			}
+
+			if lease != nil {
+				// a standby that takes over publishes the checkpoints it held back
+				for _, s := range schedulers {
+					lease.OnAcquire(s.Republish)
+				}
+				wg.Go(func() error {
+					lease.Run(closeCtx)
+					return nil
+				})
+			}
+
+			wg.Go(func() (err error) {
 				defer closeCancel()
 				var intervalTicker <-chan time.Time
 				if *checkpointInterval <= 0 {
@@ -148,11 +383,11 @@ func main() {
 					}
 				}
 
-				tip, err := monerod.HeaderTip()
+				tip, err := monerod.HeaderTip(closeCtx)
 				if err != nil {
 					slog.Error("Error getting tip", "error", err)
 					return err
-				} else if err = monerod.Walk(tip, MaxInclusionDepth, nil); err != nil {
+				} else if err = monerod.Walk(closeCtx, tip, MaxInclusionDepth, nil); err != nil {
 					slog.Error("Error getting walking tips", "error", err)
 					return err
 				}
@@ -160,16 +395,16 @@ func main() {
 
 				var tipCheckpoint *BlockHeader
 				if check.Id != types.ZeroHash {
-					tipCheckpoint, err = monerod.HeaderById(check.Id)
+					tipCheckpoint, err = monerod.HeaderById(closeCtx, check.Id)
 					if err != nil {
 						slog.Error("Error getting checkpoint tip", "error", err)
 						return err
-					} else if err = monerod.Walk(tipCheckpoint, MaxInclusionDepth, nil); err != nil {
+					} else if err = monerod.Walk(closeCtx, tipCheckpoint, MaxInclusionDepth, nil); err != nil {
 						slog.Error("Error getting checkpoint walking tips", "error", err)
 						return err
 					}
 
-					if ok, reason := monerod.HeaderIncluded(tip, tipCheckpoint); !ok {
+					if ok, reason := monerod.HeaderIncluded(closeCtx, tip, tipCheckpoint); !ok {
 						slog.Error("Tip does not include old checkpoint", "reason", reason)
 						// we have reorg'd! this is not compatible and we have to wait till monero reorgs. keep crashing until we have a valid condition
 
@@ -177,24 +412,58 @@ func main() {
 					}
 				}
 
-				fallbackTimer := time.Tick(time.Second * 30)
+				// time each tip height was first seen, to account publish latency from when a block reached checkpoint depth
+				tipSeen := make(map[uint64]time.Time)
+
+				fallbackTimer := time.Tick(fallbackInterval)
 				var checkedTicker bool
+
+				// each check of the tip is traced from the notification or timer that woke it up
+				var span trace.Span
+				defer func() {
+					if span != nil {
+						if err != nil {
+							span.RecordError(err)
+							span.SetStatus(codes.Error, err.Error())
+						}
+						span.End()
+					}
+				}()
+				trigger := "start"
 				for {
-					newTip, err := monerod.HeaderTip()
+					if span != nil {
+						span.End()
+					}
+					var ctx context.Context
+					ctx, span = tracer.Start(closeCtx, "checkpointer.check", trace.WithAttributes(attribute.String("checkpointer.trigger", trigger)))
+					trigger = "recheck"
+
+					newTip, err := monerod.HeaderTip(ctx)
 					if err != nil {
 						slog.Error("Error getting tip", "error", err)
 						return err
 					}
+					span.SetAttributes(
+						attribute.Int64("monero.tip.height", int64(newTip.Height)),
+						attribute.String("monero.tip.id", newTip.Id.String()),
+					)
 
 					if newTip.Id == tip.Id && !checkedTicker {
+						// do not trace the wait
+						span.End()
+						span = nil
+
 						// wait
 						checkedTicker = false
 						select {
 						case <-fallbackTimer:
+							trigger = "fallback"
 						case <-intervalTicker:
 							checkedTicker = true
-						case h := <-tipNotifier:
+							trigger = "interval"
+						case h := <-tipNotifier.C():
 							slog.Info("Got tip notification", "height", h.Height, "id", h.Id)
+							trigger = "zmq"
 						}
 
 						// same
@@ -202,7 +471,16 @@ func main() {
 					}
 					slog.Info("Tip", "height", newTip.Height, "id", newTip.Id)
 
-					if ok, reason := monerod.HeaderIncluded(newTip, tip); !ok {
+					if _, ok := tipSeen[newTip.Height]; !ok {
+						tipSeen[newTip.Height] = time.Now()
+					}
+					for height := range tipSeen {
+						if height+MaxInclusionDepth < newTip.Height {
+							delete(tipSeen, height)
+						}
+					}
+
+					if ok, reason := monerod.HeaderIncluded(ctx, newTip, tip); !ok {
 						slog.Error("New tip does not include old tip chain", "reason", reason)
 						// we have reorg'd!
 					}
@@ -220,7 +498,7 @@ func main() {
 					}
 
 					if tipCheckpoint != nil {
-						if ok, reason := monerod.HeaderIncluded(newTip, tipCheckpoint); !ok {
+						if ok, reason := monerod.HeaderIncluded(ctx, newTip, tipCheckpoint); !ok {
 							slog.Error("New tip does not include old checkpoint", "reason", reason)
 							// we have reorg'd! this is not compatible and we have to wait till monero reorgs. keep crashing until we have a valid condition
 
@@ -228,22 +506,49 @@ func main() {
 						}
 					}
 
-					newCheckpoint, err := monerod.HeaderAtDepth(newTip, *checkpointDepth)
+					// raised by the depth alt block policy, publish latency is measured from reaching it
+					depth := *checkpointDepth
+					newCheckpoint, err := monerod.HeaderAtDepth(ctx, newTip, depth)
 					if err != nil {
 						slog.Error("Error getting new checkpoint depth", "error", err)
 						return err
 					}
 
+					if *altBlockPolicy != "ignore" {
+						if altBlocks, err := monerod.AltBlocksAbove(ctx, newCheckpoint.Height); err != nil {
+							// an unknown fork is treated like a found one, wait for the next tip
+							slog.Warn("Error getting alternative blocks, delaying", "height", newCheckpoint.Height, "error", err)
+							tip = newTip
+							checkedTicker = false
+							continue
+						} else if len(altBlocks) > 0 {
+							slog.Warn("Alternative blocks found at or above checkpoint height", "height", newCheckpoint.Height, "alt_height", altBlocks[0].Height, "alt_id", altBlocks[0].Id, "count", len(altBlocks), "policy", *altBlockPolicy)
+
+							if *altBlockPolicy == "delay" {
+								tip = newTip
+								checkedTicker = false
+								continue
+							}
+
+							depth += *altBlockExtraDepth
+							newCheckpoint, err = monerod.HeaderAtDepth(ctx, newTip, depth)
+							if err != nil {
+								slog.Error("Error getting new checkpoint depth", "error", err)
+								return err
+							}
+						}
+					}
+
 					//sanity check again
 					if tipCheckpoint != nil {
-						if ok, reason := monerod.HeaderIncluded(newCheckpoint, tipCheckpoint); !ok {
+						if ok, reason := monerod.HeaderIncluded(ctx, newCheckpoint, tipCheckpoint); !ok {
 							slog.Error("New checkpoint does not include old checkpoint", "reason", reason)
 
 							return fmt.Errorf("checkpoint does not include old checkpoint: %s", reason)
 						}
 					}
 
-					if tipCheckpoint == nil || newCheckpoint.Height > tipCheckpoint.Height {
+					if (tipCheckpoint == nil || newCheckpoint.Height > tipCheckpoint.Height) && breaker.Check(ctx, newCheckpoint, verifiers) {
 						check = checkpoint.Checkpoint{
 							Height: newCheckpoint.Height,
 							Id:     newCheckpoint.Id,
@@ -251,31 +556,39 @@ func main() {
 
 						tipCheckpoint = newCheckpoint
 
+						history = append(checkpoint.Checkpoints{check}, history...)
+						history = history[:min(len(history), max(1, *checkpointHistory))]
+
 						slog.Info("New checkpoint", "height", newCheckpoint.Height, "id", newCheckpoint.Id)
+						span.SetAttributes(
+							attribute.Int64("checkpoint.height", int64(check.Height)),
+							attribute.String("checkpoint.id", check.Id.String()),
+						)
 
 						// sanity check: does monerod have the block?
-						if _, err := monerod.FetchHeaderById(check.Id); err != nil {
+						if _, err := monerod.FetchHeaderById(ctx, check.Id); err != nil {
 							slog.Error("Error fetching checkpoint", "height", newCheckpoint.Height, "id", newCheckpoint.Id, "error", err)
 
 							return err
 						}
 
 						if *checkpointStatePath != "" {
-							checkpointsState := MoneroCheckpoints{
-								Hashlines: []MoneroCheckpoint{
-									{
-										Height: check.Height,
-										Hash:   check.Id,
-									},
-								},
+							stateLock.Lock()
+							checkpointState.Hashlines = checkpointState.Hashlines[:0]
+							for _, h := range history {
+								checkpointState.Hashlines = append(checkpointState.Hashlines, MoneroCheckpoint{
+									Height: h.Height,
+									Hash:   h.Id,
+								})
 							}
-							blob, err := json.MarshalIndent(&checkpointsState, "", "    ")
-							if err != nil {
-								slog.Error("Error marshaling checkpoint state", "error", err)
+							checkpointState.Tip = &MoneroCheckpoint{
+								Height: newTip.Height,
+								Hash:   newTip.Id,
 							}
 
 							// atomically write new ones before pushing
-							err = WriteFile(*checkpointStatePath, blob, 0777)
+							err := checkpointState.Save(*checkpointStatePath)
+							stateLock.Unlock()
 							if err != nil {
 								slog.Error("Error writing checkpoint file", "error", err)
 
@@ -283,17 +596,34 @@ func main() {
 							}
 						}
 
-						// Send updates to checkpointers
-						// deadline for each
-						for i, c := range checkpointers {
-							if err := func() error {
-								ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+						depthReachedAt, ok := tipSeen[check.Height+depth]
+						if !ok {
+							depthReachedAt = time.Now()
+						}
+
+						if lease != nil && !lease.Leader() {
+							// the leader publishes, check it agrees
+							verify := check
+							verifyTrace := span.SpanContext()
+							wg.Go(func() error {
+								ctx, cancel := context.WithTimeout(trace.ContextWithSpanContext(closeCtx, verifyTrace), *pushTimeout)
 								defer cancel()
-								return c.Send(dialer, ctx, checkpoint.Checkpoints{check})
-							}(); err != nil {
-								slog.Error("Error sending checkpoint", "index", i, "error", err)
-								// errors are fine here
-							}
+								if err := lease.Verify(ctx, verify); err != nil {
+									slog.Warn("Standby could not verify checkpoint published by leader", "height", verify.Height, "id", verify.Id, "error", err)
+								} else {
+									slog.Info("Standby verified checkpoint published by leader", "height", verify.Height, "id", verify.Id)
+								}
+								return nil
+							})
+						}
+
+						// Send updates to checkpointers, each publishes at its own schedule
+						for _, s := range schedulers {
+							s.Schedule(PublishJob{
+								History:        slices.Clone(history),
+								DepthReachedAt: depthReachedAt,
+								Trace:          span.SpanContext(),
+							})
 						}
 					}
 
@@ -303,45 +633,68 @@ func main() {
 
 			})
 
-			zmqClient := zmq.NewClient(*zmqAddr)
+			if len(rpcUrls.Values) > 1 {
+				wg.Go(func() error {
+					ticker := time.NewTicker(time.Second * 30)
+					defer ticker.Stop()
+					for {
+						select {
+						case <-closeCtx.Done():
+							return nil
+						case <-ticker.C:
+							monerod.Probe()
+						}
+					}
+				})
+			}
 
-			wg.Go(func() error {
-				defer closeCancel()
-				for {
+			// the same block is announced by each endpoint
+			notifyDeduplicator := NewNotifyDeduplicator()
 
-					select {
-					case <-closeCtx.Done():
-						return nil
-					default:
-					}
-					err := zmqClient.Listen(context.Background(), zmq.Listeners{
-						zmq.TopicMinimalChainMain: zmq.DecoderMinimalChainMain(func(chainMain *zmq.MinimalChainMain) {
-							if len(chainMain.Ids) == 0 {
-								return
-							}
-							root := NotifyHeader{
-								Height:     chainMain.FirstHeight,
-								Id:         chainMain.Ids[0],
-								PreviousId: chainMain.FirstPrevID,
-							}
-							select {
-							case tipNotifier <- root:
-							case <-closeCtx.Done():
-								return
-							}
-						}),
-					})
-					if err != nil {
-						slog.Error("Error listening zmq", "error", err)
+			var zmqClients []*zmq.Client
+			for _, zmqAddr := range zmqAddrs.Values {
+				zmqClient := zmq.NewClient(zmqAddr)
+				zmqClients = append(zmqClients, zmqClient)
+
+				wg.Go(func() error {
+					defer closeCancel()
+					for {
+
+						select {
+						case <-closeCtx.Done():
+							return nil
+						default:
+						}
+						err := zmqClient.Listen(context.Background(), zmq.Listeners{
+							zmq.TopicMinimalChainMain: zmq.DecoderMinimalChainMain(func(chainMain *zmq.MinimalChainMain) {
+								if len(chainMain.Ids) == 0 {
+									return
+								}
+								root := NotifyHeader{
+									Height:     chainMain.FirstHeight,
+									Id:         chainMain.Ids[0],
+									PreviousId: chainMain.FirstPrevID,
+								}
+								if !notifyDeduplicator.First(root.Id) {
+									return
+								}
+								tipNotifier.Push(root)
+							}),
+						})
+						if err != nil {
+							slog.Error("Error listening zmq", "zmq", zmqAddr, "error", err)
+						}
 					}
-				}
-			})
+				})
+			}
 
 			if err := wg.Wait(); err != nil {
 				panic(err)
 			}
 
-			_ = zmqClient.Close()
+			for _, zmqClient := range zmqClients {
+				_ = zmqClient.Close()
+			}
 		}()
 
 	}
@@ -9,21 +9,22 @@ import (
 	"sync"
 	"time"
 
-	"git.gammaspectra.live/P2Pool/consensus/v4/monero/client/rpc"
 	"git.gammaspectra.live/P2Pool/consensus/v4/monero/client/rpc/daemon"
 	"git.gammaspectra.live/P2Pool/consensus/v4/types"
 )
 
 type Daemon struct {
-	rpc     *rpc.Client
-	daemon  *daemon.Client
-	timeout time.Duration
+	backends []*DaemonBackend
+	timeout  time.Duration
 
 	lock   sync.RWMutex
 	blocks map[types.Hash]*BlockHeader
 
 	restricted bool
-	rateLimit  *time.Ticker
+	// headersRange Whether all backends support get_block_headers_range
+	headersRange bool
+	netType      string
+	rateLimit    *time.Ticker
 }
 
 type BlockHeader struct {
@@ -35,24 +36,31 @@ type BlockHeader struct {
 	CumulativeDifficulty types.Difficulty `json:"cumulative_difficulty"`
 }
 
-func NewDaemon(rpcUrl string, client *http.Client, timeout time.Duration) (*Daemon, error) {
-	rpcServer, err := rpc.NewClient(rpcUrl, rpc.WithHTTPClient(client))
-	if err != nil {
-		return nil, err
+// NewDaemon Creates a client over one or more monerod RPC endpoints. Requests are routed to the fastest healthy endpoint,
+// except the tip, which is asked from all healthy endpoints
+func NewDaemon(rpcUrls []string, client *http.Client, timeout time.Duration) (*Daemon, error) {
+	if len(rpcUrls) == 0 {
+		return nil, errors.New("no rpc urls")
 	}
 
-	moneroDaemon := daemon.NewClient(rpcServer)
-
 	d := &Daemon{
 		timeout:    timeout,
-		rpc:        rpcServer,
-		daemon:     moneroDaemon,
 		blocks:     make(map[types.Hash]*BlockHeader),
 		restricted: true,
+		// until disabled by DetectCapabilities, Walk falls back on errors
+		headersRange: true,
 		// allow 1000 requests per second
 		rateLimit: time.NewTicker(time.Second / 1000),
 	}
 
+	for _, rpcUrl := range rpcUrls {
+		b, err := NewDaemonBackend(rpcUrl, client)
+		if err != nil {
+			return nil, err
+		}
+		d.backends = append(d.backends, b)
+	}
+
 	return d, nil
 }
 
@@ -75,7 +83,7 @@ func headerFromRPC(h daemon.BlockHeader) *BlockHeader {
 const MaxInclusionDepth = 720
 
 // HeaderIncluded Walks a chain backwards via previous id hashes to find if root is part of the chain tip is on
-func (d *Daemon) HeaderIncluded(tip, root *BlockHeader) (ok bool, reason error) {
+func (d *Daemon) HeaderIncluded(ctx context.Context, tip, root *BlockHeader) (ok bool, reason error) {
 	if tip == nil || root == nil {
 		return false, errors.New("tip or root is nil")
 	}
@@ -96,7 +104,7 @@ func (d *Daemon) HeaderIncluded(tip, root *BlockHeader) (ok bool, reason error)
 	inclusionDepth := min(tip.Height-root.Height, MaxInclusionDepth)
 
 	var found bool
-	err := d.Walk(tip, inclusionDepth, func(h *BlockHeader) (ok bool) {
+	err := d.Walk(ctx, tip, inclusionDepth, func(h *BlockHeader) (ok bool) {
 		// found root
 		if h.Height == root.Height && h.Id == root.Id {
 			// tip is included
@@ -117,7 +125,7 @@ func (d *Daemon) HeaderIncluded(tip, root *BlockHeader) (ok bool, reason error)
 }
 
 // Walk Walks a chain backwards via previous id hashes. Limit is in depths from tip
-func (d *Daemon) Walk(tip *BlockHeader, limit uint64, each func(h *BlockHeader) (ok bool)) (err error) {
+func (d *Daemon) Walk(ctx context.Context, tip *BlockHeader, limit uint64, each func(h *BlockHeader) (ok bool)) (err error) {
 	if tip == nil {
 		return errors.New("tip is nil")
 	}
@@ -125,8 +133,20 @@ func (d *Daemon) Walk(tip *BlockHeader, limit uint64, each func(h *BlockHeader)
 	// add a sanity limit
 	inclusionDepth := limit
 
+	// use height ranges while the chain is linear
+	d.lock.RLock()
+	useRange := d.headersRange
+	d.lock.RUnlock()
+
 	for tip.Height > 0 && inclusionDepth > 0 {
-		parent, err := d.HeaderById(tip.PreviousId)
+		if useRange && inclusionDepth >= minRangeWalk && d.headerById(tip.PreviousId) == nil {
+			if linked, err := d.prefetchRange(ctx, tip, min(inclusionDepth, maxRangeWalk)); err != nil || linked == 0 {
+				// fallback to hash-by-hash walking, around a reorg point or unsupported daemon
+				useRange = false
+			}
+		}
+
+		parent, err := d.HeaderById(ctx, tip.PreviousId)
 		if err != nil {
 			return fmt.Errorf("while obtaining block %s @ %d: %w", tip.PreviousId, tip.Height-1, err)
 		}
@@ -147,12 +167,76 @@ func (d *Daemon) Walk(tip *BlockHeader, limit uint64, each func(h *BlockHeader)
 	return nil
 }
 
+// minRangeWalk Minimum remaining depth to fetch headers by height range instead of by hash
+const minRangeWalk = 8
+
+// maxRangeWalk Maximum headers to fetch in one range, as limited by restricted RPC
+const maxRangeWalk = 1000
+
+// prefetchRange Fetches up to count main chain headers below tip by height, and caches those that link back to tip via previous id.
+// Returns how many headers were linked. Fewer than count means the main chain diverges from tip
+func (d *Daemon) prefetchRange(ctx context.Context, tip *BlockHeader, count uint64) (linked uint64, err error) {
+	count = min(count, tip.Height)
+	if count == 0 {
+		return 0, nil
+	}
+
+	var r struct {
+		rpcStatus
+		Headers []struct {
+			Height                    uint64     `json:"height"`
+			Hash                      types.Hash `json:"hash"`
+			PrevHash                  types.Hash `json:"prev_hash"`
+			Difficulty                uint64     `json:"difficulty"`
+			DifficultyTop64           uint64     `json:"difficulty_top64"`
+			CumulativeDifficulty      uint64     `json:"cumulative_difficulty"`
+			CumulativeDifficultyTop64 uint64     `json:"cumulative_difficulty_top64"`
+		} `json:"headers"`
+	}
+	err = d.call(ctx, "get_block_headers_range", func(ctx context.Context, b *DaemonBackend) error {
+		err := b.jsonRPC(ctx, "get_block_headers_range", map[string]uint64{
+			"start_height": tip.Height - count,
+			"end_height":   tip.Height - 1,
+		}, &r)
+		if err != nil {
+			return err
+		}
+		return r.Err()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	expected := tip
+	for i := len(r.Headers) - 1; i >= 0; i-- {
+		h := r.Headers[i]
+		if h.Height != expected.Height-1 || h.Hash != expected.PreviousId {
+			break
+		}
+		header := &BlockHeader{
+			Height:               h.Height,
+			Id:                   h.Hash,
+			PreviousId:           h.PrevHash,
+			Difficulty:           types.NewDifficulty(h.Difficulty, h.DifficultyTop64),
+			CumulativeDifficulty: types.NewDifficulty(h.CumulativeDifficulty, h.CumulativeDifficultyTop64),
+		}
+		d.blocks[header.Id] = header
+		expected = header
+		linked++
+	}
+
+	return linked, nil
+}
+
 // HeaderAtDepth Fetches a header at a specific depth from tip
-func (d *Daemon) HeaderAtDepth(tip *BlockHeader, depth uint64) (deepHeader *BlockHeader, err error) {
+func (d *Daemon) HeaderAtDepth(ctx context.Context, tip *BlockHeader, depth uint64) (deepHeader *BlockHeader, err error) {
 	if depth == 0 {
 		return tip, nil
 	}
-	err = d.Walk(tip, depth, func(h *BlockHeader) (ok bool) {
+	err = d.Walk(ctx, tip, depth, func(h *BlockHeader) (ok bool) {
 		if h.Height == tip.Height-depth {
 			deepHeader = h
 			return false
@@ -162,23 +246,33 @@ func (d *Daemon) HeaderAtDepth(tip *BlockHeader, depth uint64) (deepHeader *Bloc
 	return deepHeader, err
 }
 
-func (d *Daemon) HeaderTip() (*BlockHeader, error) {
-	<-d.rateLimit.C
+// HeaderTip Returns the tip with the highest cumulative difficulty across backends.
+// Taking it from whichever backend is fastest could step back to a lagging backend's tip
+func (d *Daemon) HeaderTip(ctx context.Context) (*BlockHeader, error) {
+	var lock sync.Mutex
+	var h *BlockHeader
+	err := d.callEach(ctx, "get_last_block_header", func(ctx context.Context, b *DaemonBackend) error {
+		r, err := b.daemon.GetLastBlockHeader(ctx)
+		if err != nil {
+			return err
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
-	defer cancel()
+		if r.BlockHeader.Hash == types.ZeroHash {
+			return fmt.Errorf("expected block header to have valid hash")
+		}
 
-	r, err := d.daemon.GetLastBlockHeader(ctx)
+		tip := headerFromRPC(r.BlockHeader)
+		lock.Lock()
+		defer lock.Unlock()
+		if h == nil || tip.CumulativeDifficulty.Cmp(h.CumulativeDifficulty) > 0 {
+			h = tip
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if r.BlockHeader.Hash == types.ZeroHash {
-		return nil, fmt.Errorf("expected block header to have valid hash")
-	}
-
-	h := headerFromRPC(r.BlockHeader)
-
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	d.blocks[h.Id] = h
@@ -186,33 +280,36 @@ func (d *Daemon) HeaderTip() (*BlockHeader, error) {
 	return h, nil
 }
 
-func (d *Daemon) HeaderById(id types.Hash) (*BlockHeader, error) {
+func (d *Daemon) HeaderById(ctx context.Context, id types.Hash) (*BlockHeader, error) {
 	if h := d.headerById(id); h != nil {
 		return h, nil
 	}
-	return d.FetchHeaderById(id)
+	return d.FetchHeaderById(ctx, id)
 }
 
-func (d *Daemon) FetchHeaderById(id types.Hash) (*BlockHeader, error) {
-	<-d.rateLimit.C
-	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
-	defer cancel()
+func (d *Daemon) FetchHeaderById(ctx context.Context, id types.Hash) (*BlockHeader, error) {
+	var h *BlockHeader
+	err := d.call(ctx, "get_block_header_by_hash", func(ctx context.Context, b *DaemonBackend) error {
+		r, err := b.daemon.GetBlockHeaderByHash(ctx, []types.Hash{id})
+		if err != nil {
+			return err
+		}
 
-	r, err := d.daemon.GetBlockHeaderByHash(ctx, []types.Hash{id})
-	if err != nil {
-		return nil, err
-	}
+		if len(r.BlockHeaders) != 1 {
+			return fmt.Errorf("expected 1 block header")
+		}
 
-	if len(r.BlockHeaders) != 1 {
-		return nil, fmt.Errorf("expected 1 block header")
-	}
+		if r.BlockHeaders[0].Hash != id {
+			return fmt.Errorf("expected block header to have hash %x, got %x", id.Slice(), r.BlockHeaders[0].Hash.Slice())
+		}
 
-	if r.BlockHeaders[0].Hash != id {
-		return nil, fmt.Errorf("expected block header to have hash %x, got %x", id.Slice(), r.BlockHeaders[0].Hash.Slice())
+		h = headerFromRPC(r.BlockHeaders[0])
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	h := headerFromRPC(r.BlockHeaders[0])
-
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	d.blocks[id] = h
@@ -220,7 +317,7 @@ func (d *Daemon) FetchHeaderById(id types.Hash) (*BlockHeader, error) {
 	return h, nil
 }
 
-func (d *Daemon) HeadersById(ids ...types.Hash) (result []*BlockHeader, err error) {
+func (d *Daemon) HeadersById(ctx context.Context, ids ...types.Hash) (result []*BlockHeader, err error) {
 	result = make([]*BlockHeader, len(ids))
 	// first fetch all we can!
 	if found := func() (found int) {
@@ -249,20 +346,24 @@ func (d *Daemon) HeadersById(ids ...types.Hash) (result []*BlockHeader, err erro
 			return nil, fmt.Errorf("restricted: at most %d blocks can be requested, got %d", 1000, len(request))
 		}
 
-		<-d.rateLimit.C
-		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
-		defer cancel()
+		var headers []daemon.BlockHeader
+		err := d.call(ctx, "get_block_header_by_hash", func(ctx context.Context, b *DaemonBackend) error {
+			r, err := b.daemon.GetBlockHeaderByHash(ctx, request)
+			if err != nil {
+				return err
+			}
 
-		r, err := d.daemon.GetBlockHeaderByHash(ctx, request)
+			if len(r.BlockHeaders) != len(request) {
+				return fmt.Errorf("wrong block header count")
+			}
+			headers = r.BlockHeaders
+			return nil
+		})
 		if err != nil {
 			return result, err
 		}
 
-		if len(r.BlockHeaders) != len(request) {
-			return result, fmt.Errorf("wrong block header count")
-		}
-
-		for _, h := range r.BlockHeaders {
+		for _, h := range headers {
 			if i := slices.Index(ids, h.Hash); i == -1 {
 				return result, fmt.Errorf("mismatched block id: not found")
 			} else if result[i] != nil {
@@ -287,3 +388,34 @@ func (d *Daemon) HeadersById(ids ...types.Hash) (result []*BlockHeader, err erro
 		return result, nil
 	}
 }
+
+// AltBlocksAbove Returns known alternative blocks at or above height
+func (d *Daemon) AltBlocksAbove(ctx context.Context, height uint64) (result []*BlockHeader, err error) {
+	var r struct {
+		rpcStatus
+		Hashes []types.Hash `json:"blks_hashes"`
+	}
+	err = d.call(ctx, "get_alt_blocks_hashes", func(ctx context.Context, b *DaemonBackend) error {
+		if err := b.rawRequest(ctx, "get_alt_blocks_hashes", nil, &r); err != nil {
+			return err
+		}
+		return r.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// alternative blocks are never pruned by monerod while running, fetch in batches
+	for ids := range slices.Chunk(r.Hashes, 1000) {
+		headers, err := d.HeadersById(ctx, ids...)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range headers {
+			if h.Height >= height {
+				result = append(result, h)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"sync"
+
+	"git.gammaspectra.live/P2Pool/consensus/v4/types"
+)
+
+// maxSeenNotifications Number of recent tip ids remembered for deduplication
+const maxSeenNotifications = 64
+
+// NotifyDeduplicator Drops tip notifications already received from another ZMQ endpoint
+type NotifyDeduplicator struct {
+	lock  sync.Mutex
+	seen  map[types.Hash]struct{}
+	order []types.Hash
+}
+
+func NewNotifyDeduplicator() *NotifyDeduplicator {
+	return &NotifyDeduplicator{
+		seen: make(map[types.Hash]struct{}, maxSeenNotifications),
+	}
+}
+
+// First Returns true only the first time id is seen
+func (d *NotifyDeduplicator) First(id types.Hash) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.seen[id]; ok {
+		return false
+	}
+	if len(d.order) >= maxSeenNotifications {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+	d.seen[id] = struct{}{}
+	d.order = append(d.order, id)
+	return true
+}
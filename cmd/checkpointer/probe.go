@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"time"
+)
+
+// DaemonCapabilities Features of a monerod endpoint, detected at startup
+type DaemonCapabilities struct {
+	// Version RPC version, major in the upper 16 bits
+	Version       uint32 `json:"version"`
+	Release       bool   `json:"release"`
+	DaemonVersion string `json:"daemon_version"`
+	NetType       string `json:"nettype"`
+	Restricted    bool   `json:"restricted"`
+	Synchronized  bool   `json:"synchronized"`
+	Height        uint64 `json:"height"`
+
+	// HeadersRange Whether get_block_headers_range is available, used to walk the chain in batches
+	HeadersRange bool `json:"headers_range"`
+	// AltBlocks Whether get_alt_blocks_hashes is available, required by -alt-block-policy
+	AltBlocks bool `json:"alt_blocks"`
+}
+
+func (c DaemonCapabilities) VersionString() string {
+	return fmt.Sprintf("%d.%d", c.Version>>16, c.Version&0xffff)
+}
+
+// probe Detects the capabilities of this backend
+func (b *DaemonBackend) probe(ctx context.Context) (caps DaemonCapabilities, err error) {
+	var version struct {
+		rpcStatus
+		Version uint32 `json:"version"`
+		Release bool   `json:"release"`
+	}
+	if err = b.jsonRPC(ctx, "get_version", nil, &version); err != nil {
+		return caps, fmt.Errorf("get_version: %w", err)
+	} else if err = version.Err(); err != nil {
+		return caps, fmt.Errorf("get_version: %w", err)
+	}
+	caps.Version = version.Version
+	caps.Release = version.Release
+
+	var info struct {
+		rpcStatus
+		Height       uint64 `json:"height"`
+		NetType      string `json:"nettype"`
+		Restricted   bool   `json:"restricted"`
+		Synchronized bool   `json:"synchronized"`
+		Offline      bool   `json:"offline"`
+		Version      string `json:"version"`
+	}
+	if err = b.jsonRPC(ctx, "get_info", nil, &info); err != nil {
+		return caps, fmt.Errorf("get_info: %w", err)
+	} else if err = info.Err(); err != nil {
+		return caps, fmt.Errorf("get_info: %w", err)
+	}
+	if info.Height == 0 {
+		return caps, errors.New("get_info: daemon has no blocks")
+	}
+	caps.Height = info.Height
+	caps.NetType = info.NetType
+	caps.Restricted = info.Restricted
+	caps.Synchronized = info.Synchronized && !info.Offline
+	caps.DaemonVersion = info.Version
+
+	var headers struct {
+		rpcStatus
+	}
+	if err := b.jsonRPC(ctx, "get_block_headers_range", map[string]uint64{
+		"start_height": info.Height - 1,
+		"end_height":   info.Height - 1,
+	}, &headers); err == nil && headers.Err() == nil {
+		caps.HeadersRange = true
+	}
+
+	var alt struct {
+		rpcStatus
+	}
+	if err := b.rawRequest(ctx, "get_alt_blocks_hashes", nil, &alt); err == nil && alt.Err() == nil {
+		caps.AltBlocks = true
+	}
+
+	return caps, nil
+}
+
+// DetectCapabilities Probes all backends and adjusts batch sizes and features to what all usable backends support.
+// Backends failing to probe are kept, as they might recover later. Fails if none can be probed, if backends are on
+// different networks, or if requireAltBlocks is set and alternative blocks cannot be listed
+func (d *Daemon) DetectCapabilities(requireAltBlocks bool) error {
+	var usable []DaemonCapabilities
+	var lastErr error
+	for _, b := range d.backends {
+		caps, err := func() (DaemonCapabilities, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+			defer cancel()
+			return b.probe(ctx)
+		}()
+		if err != nil {
+			slog.Error("Failed to probe monerod capabilities", "rpc", b.url, "error", err)
+			lastErr = err
+			continue
+		}
+		b.lock.Lock()
+		b.capabilities = &caps
+		b.lock.Unlock()
+
+		slog.Info("Probed monerod", "rpc", b.url, "version", caps.DaemonVersion, "rpc_version", caps.VersionString(), "nettype", caps.NetType, "restricted", caps.Restricted, "synchronized", caps.Synchronized, "height", caps.Height, "headers_range", caps.HeadersRange, "alt_blocks", caps.AltBlocks)
+		if !caps.Synchronized {
+			slog.Warn("monerod is not synchronized, checkpoints will lag behind the network", "rpc", b.url, "height", caps.Height)
+		}
+		usable = append(usable, caps)
+	}
+
+	if len(usable) == 0 {
+		return fmt.Errorf("no monerod could be probed: %w", lastErr)
+	}
+
+	restricted := false
+	headersRange := true
+	for _, caps := range usable {
+		if caps.NetType != usable[0].NetType {
+			return fmt.Errorf("monerod endpoints are on different networks: %s and %s", usable[0].NetType, caps.NetType)
+		}
+		if requireAltBlocks && !caps.AltBlocks {
+			return errors.New("get_alt_blocks_hashes is not available, required by -alt-block-policy")
+		}
+		restricted = restricted || caps.Restricted
+		headersRange = headersRange && caps.HeadersRange
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.restricted = restricted
+	d.headersRange = headersRange
+	d.netType = usable[0].NetType
+	return nil
+}
+
+// NetType Returns the network of the backends, as detected by DetectCapabilities
+func (d *Daemon) NetType() string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.netType
+}
+
+// probeZMQ Checks a ZMQ-PUB address accepts connections. Topics cannot be listed, monerod publishes all of them when enabled
+func probeZMQ(addr string, timeout time.Duration) error {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "tcp" {
+		return fmt.Errorf("unsupported zmq scheme %s", u.Scheme)
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
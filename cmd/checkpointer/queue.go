@@ -0,0 +1,65 @@
+package main
+
+import (
+	"expvar"
+	"log/slog"
+	"sync/atomic"
+)
+
+var queueMetrics = expvar.NewMap("queues")
+
+// QueueStats Current state of a DropQueue
+type QueueStats struct {
+	Length   int    `json:"length"`
+	Capacity int    `json:"capacity"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+// DropQueue Bounded queue that never blocks producers. When full, the oldest entry is dropped in favor of the new one
+type DropQueue[T any] struct {
+	name    string
+	c       chan T
+	dropped atomic.Uint64
+}
+
+// NewDropQueue Creates a queue of size entries, exposed as name in the queues metrics
+func NewDropQueue[T any](name string, size int) *DropQueue[T] {
+	q := &DropQueue[T]{
+		name: name,
+		c:    make(chan T, max(1, size)),
+	}
+	queueMetrics.Set(name, expvar.Func(func() any {
+		return q.Stats()
+	}))
+	return q
+}
+
+// Push Adds v to the queue, dropping the oldest entry if full
+func (q *DropQueue[T]) Push(v T) {
+	for {
+		select {
+		case q.c <- v:
+			return
+		default:
+		}
+		select {
+		case <-q.c:
+			q.dropped.Add(1)
+			slog.Debug("Queue is full, dropped oldest entry", "queue", q.name)
+		default:
+		}
+	}
+}
+
+// C Channel to receive entries from
+func (q *DropQueue[T]) C() <-chan T {
+	return q.c
+}
+
+func (q *DropQueue[T]) Stats() QueueStats {
+	return QueueStats{
+		Length:   len(q.c),
+		Capacity: cap(q.c),
+		Dropped:  q.dropped.Load(),
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// rawRequest Calls a monerod "other" RPC endpoint directly, for calls not covered by the daemon client
+func (b *DaemonBackend) rawRequest(ctx context.Context, endpoint string, params, response any) error {
+	uri, err := url.JoinPath(b.url, endpoint)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	if params != nil {
+		if body, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	r, err := b.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned non-200 status code: %d", endpoint, r.StatusCode)
+	}
+
+	return json.NewDecoder(r.Body).Decode(response)
+}
+
+type rpcStatus struct {
+	Status    string `json:"status"`
+	Untrusted bool   `json:"untrusted"`
+}
+
+func (s rpcStatus) Err() error {
+	if s.Status != "OK" {
+		return fmt.Errorf("rpc returned status %q", s.Status)
+	}
+	return nil
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *jsonRPCError) Error() string {
+	return fmt.Sprintf("json_rpc error %d: %s", e.Code, e.Message)
+}
+
+// jsonRPC Calls a monerod JSON-RPC method directly, for calls not covered by the daemon client
+func (b *DaemonBackend) jsonRPC(ctx context.Context, method string, params, result any) error {
+	request := struct {
+		JSONRPC string `json:"jsonrpc"`
+		Id      string `json:"id"`
+		Method  string `json:"method"`
+		Params  any    `json:"params,omitempty"`
+	}{
+		JSONRPC: "2.0",
+		Id:      "0",
+		Method:  method,
+		Params:  params,
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *jsonRPCError   `json:"error"`
+	}
+	if err := b.rawRequest(ctx, "json_rpc", request, &response); err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	return json.Unmarshal(response.Result, result)
+}
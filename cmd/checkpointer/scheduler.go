@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/highway/checkpoint"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PublishJob Checkpoints to publish after a new checkpoint is selected
+type PublishJob struct {
+	// History Most recent checkpoints, highest first
+	History checkpoint.Checkpoints
+	// DepthReachedAt When the newest checkpoint reached checkpoint depth
+	DepthReachedAt time.Time
+	// Trace Span of the tip check that selected the checkpoint, publishing is traced as its child
+	Trace trace.SpanContext
+}
+
+const (
+	// retryBackoff Delay before the first retry of a failed publish, doubled on each consecutive failure
+	retryBackoff = time.Second * 30
+	// retryMaxBackoff Upper bound of the delay between retries of a failed publish
+	retryMaxBackoff = time.Minute * 10
+)
+
+// TargetScheduler Publishes to one push target at the cadence of its schedule, independently of other targets.
+// A newer job replaces a pending one, so a target that is not due yet publishes only the most recent checkpoints
+type TargetScheduler struct {
+	Index  int
+	Config checkpoint.Config
+
+	jobs        *DropQueue[PublishJob]
+	lastPublish time.Time
+
+	// republish Signals that the lease was acquired and the job held on standby should be published
+	republish chan struct{}
+	// standby Last job not published on standby, only accessed by Run
+	standby *PublishJob
+}
+
+// NewTargetScheduler Creates a scheduler for config, at index in the push config. lastPublish is restored from state
+func NewTargetScheduler(index int, config checkpoint.Config, lastPublish time.Time) *TargetScheduler {
+	return &TargetScheduler{
+		Index:       index,
+		Config:      config,
+		jobs:        NewDropQueue[PublishJob]("publish_"+config.Id(index), 1),
+		lastPublish: lastPublish,
+		republish:   make(chan struct{}, 1),
+	}
+}
+
+func (s *TargetScheduler) Id() string {
+	return s.Config.Id(s.Index)
+}
+
+// Schedule Queues job, replacing any pending one. Never blocks
+func (s *TargetScheduler) Schedule(job PublishJob) {
+	s.jobs.Push(job)
+}
+
+// Republish Publishes the last job refused with errStandby again, unless a newer one was queued since. Never blocks
+func (s *TargetScheduler) Republish() {
+	select {
+	case s.republish <- struct{}{}:
+	default:
+	}
+}
+
+// Run Publishes queued jobs via publish once the target is due, until ctx is cancelled.
+// Failed publishes do not count towards the interval, so the next job is pushed right away.
+// A job that failed with a temporary error is retried with backoff until it succeeds or a newer job is queued
+func (s *TargetScheduler) Run(ctx context.Context, publish func(job PublishJob) error) {
+	var failed PublishJob
+	var retry <-chan time.Time
+	var backoff time.Duration
+	for {
+		var job PublishJob
+		select {
+		case <-ctx.Done():
+			return
+		case job = <-s.jobs.C():
+		case <-s.republish:
+			if s.standby == nil {
+				continue
+			}
+			job = *s.standby
+			slog.Info("Republishing checkpoint held on standby", "index", s.Index, "name", s.Id(), "height", job.History[0].Height)
+		case <-retry:
+			// a newer job queued at the same time supersedes the failed one
+			select {
+			case job = <-s.jobs.C():
+			default:
+				job = failed
+				slog.Info("Retrying failed publish", "index", s.Index, "name", s.Id(), "height", job.History[0].Height)
+			}
+		}
+		retry = nil
+
+		if wait := time.Until(s.lastPublish.Add(s.Config.Schedule.Interval)); wait > 0 {
+			slog.Info("Delaying publish until target is due", "index", s.Index, "name", s.Id(), "height", job.History[0].Height, "wait", wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			// pick up checkpoints found while waiting
+			select {
+			case job = <-s.jobs.C():
+			default:
+			}
+		}
+
+		err := publish(job)
+		s.standby = nil
+		switch {
+		case err == nil:
+			s.lastPublish = time.Now()
+			backoff = 0
+		case errors.Is(err, errStandby):
+			// kept until leadership is gained, a newer job replaces it
+			s.standby = &job
+			backoff = 0
+		case checkpoint.IsPermanent(err):
+			backoff = 0
+		default:
+			backoff = min(max(backoff*2, retryBackoff), retryMaxBackoff)
+			failed = job
+			retry = time.After(backoff)
+			slog.Warn("Publish failed, retrying", "index", s.Index, "name", s.Id(), "height", job.History[0].Height, "backoff", backoff)
+		}
+	}
+}
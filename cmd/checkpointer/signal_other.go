@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// resetOnSignal Not supported on this platform, safe mode can only be left via timeout
+func resetOnSignal(b *CircuitBreaker) {
+
+}
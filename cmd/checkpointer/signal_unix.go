@@ -0,0 +1,20 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// resetOnSignal Clears safe mode when SIGUSR1 is received
+func resetOnSignal(b *CircuitBreaker) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	go func() {
+		for range c {
+			b.Reset()
+		}
+	}()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v4/types"
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/atomicfile"
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/migrate"
+)
+
+// CheckpointStateVersion Current version of the checkpoint state file. Files without version are version 0
+const CheckpointStateVersion = 1
+
+// checkpointStateSchema Migrations of the checkpoint state file, applied when loading it.
+// Migrated files must stay loadable by monerod, which only reads hashlines
+var checkpointStateSchema = migrate.Schema{
+	Name: "checkpoint-state",
+	Steps: []migrate.Step{
+		{
+			Description: "add version, tip and per-target publishes",
+			Apply: func(data []byte) ([]byte, error) {
+				return migrate.SetVersion(data, 1)
+			},
+		},
+	},
+	Indent: "    ",
+}
+
+// MoneroCheckpoints Same format as checkpoints.json used in Monero, with extra fields ignored by it
+type MoneroCheckpoints struct {
+	Hashlines []MoneroCheckpoint `json:"hashlines,omitempty"`
+
+	Version int `json:"version,omitempty"`
+	// Tip Chain tip at the time the checkpoint was selected
+	Tip *MoneroCheckpoint `json:"tip,omitempty"`
+	// Targets Last publish per push target name
+	Targets map[string]TargetState `json:"targets,omitempty"`
+
+	// unknown Fields not known to this version, preserved when saving
+	unknown map[string]json.RawMessage
+}
+
+type MoneroCheckpoint struct {
+	Hash   types.Hash `json:"hash"`
+	Height uint64     `json:"height"`
+}
+
+type TargetState struct {
+	LastPublish time.Time  `json:"last_publish,omitzero"`
+	Hash        types.Hash `json:"hash"`
+	Height      uint64     `json:"height"`
+}
+
+var knownStateFields = []string{"hashlines", "version", "tip", "targets"}
+
+func (c *MoneroCheckpoints) UnmarshalJSON(data []byte) error {
+	type plain MoneroCheckpoints
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, k := range knownStateFields {
+		delete(fields, k)
+	}
+	c.unknown = fields
+	return nil
+}
+
+func (c MoneroCheckpoints) MarshalJSON() ([]byte, error) {
+	type plain MoneroCheckpoints
+	data, err := json.Marshal(plain(c))
+	if err != nil || len(c.unknown) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range c.unknown {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+func (c *MoneroCheckpoints) Save(path string) error {
+	c.Version = CheckpointStateVersion
+	blob, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, blob, 0777)
+}
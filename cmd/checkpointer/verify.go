@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v4/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrDivergence Returned by verifiers when a source disagrees with the candidate
+var ErrDivergence = errors.New("divergence")
+
+type Verifier interface {
+	Name() string
+	// Verify Checks the candidate is part of the source main chain. Returns an error wrapping ErrDivergence on mismatch
+	// Any other error means the source could not verify the candidate.
+	Verify(ctx context.Context, candidate *BlockHeader) error
+}
+
+// DaemonVerifier Verifies candidates against the main chain of another monerod
+type DaemonVerifier struct {
+	name   string
+	daemon *Daemon
+}
+
+func NewDaemonVerifier(name string, d *Daemon) *DaemonVerifier {
+	return &DaemonVerifier{
+		name:   name,
+		daemon: d,
+	}
+}
+
+func (v *DaemonVerifier) Name() string {
+	return v.name
+}
+
+func (v *DaemonVerifier) Verify(ctx context.Context, candidate *BlockHeader) error {
+	tip, err := v.daemon.HeaderTip(ctx)
+	if err != nil {
+		return err
+	}
+	if tip.Height < candidate.Height {
+		return fmt.Errorf("tip height %d is below candidate height %d", tip.Height, candidate.Height)
+	}
+	if tip.Height-candidate.Height > MaxInclusionDepth {
+		return fmt.Errorf("candidate height %d is too deep from tip height %d", candidate.Height, tip.Height)
+	}
+	h, err := v.daemon.HeaderAtDepth(ctx, tip, tip.Height-candidate.Height)
+	if err != nil {
+		return err
+	}
+	if h == nil {
+		return errors.New("could not find header at candidate height")
+	}
+	if h.Id != candidate.Id {
+		return fmt.Errorf("%w: block at height %d is %s, expected %s", ErrDivergence, candidate.Height, h.Id, candidate.Id)
+	}
+	return nil
+}
+
+// CircuitBreaker Stops publishing once any verifier disagrees with the primary daemon.
+// It stays tripped until Reset is called, or timeout passes if set.
+type CircuitBreaker struct {
+	lock      sync.Mutex
+	timeout   time.Duration
+	trippedAt time.Time
+	reason    error
+}
+
+func NewCircuitBreaker(timeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		timeout: timeout,
+	}
+}
+
+func (b *CircuitBreaker) Trip(reason error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.reason == nil {
+		b.trippedAt = time.Now()
+	}
+	b.reason = reason
+	slog.Error("Entering safe mode, checkpoints will not be published", "reason", reason, "timeout", b.timeout)
+}
+
+func (b *CircuitBreaker) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.reason != nil {
+		slog.Warn("Leaving safe mode", "reason", b.reason)
+	}
+	b.reason = nil
+}
+
+// Tripped Returns the reason safe mode was entered, or nil if not tripped
+func (b *CircuitBreaker) Tripped() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.reason != nil && b.timeout > 0 && time.Since(b.trippedAt) >= b.timeout {
+		slog.Warn("Leaving safe mode after timeout", "reason", b.reason)
+		b.reason = nil
+	}
+	return b.reason
+}
+
+// Check Verifies candidate against all verifiers, tripping on divergence. Returns false if publishing must be skipped
+func (b *CircuitBreaker) Check(ctx context.Context, candidate *BlockHeader, verifiers []Verifier) bool {
+	for _, v := range verifiers {
+		ctx, span := tracer.Start(ctx, "checkpointer.verify", trace.WithAttributes(attribute.String("checkpointer.verifier", v.Name())))
+		err := v.Verify(ctx, candidate)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+
+		if errors.Is(err, ErrDivergence) {
+			b.Trip(fmt.Errorf("verifier %s: %w", v.Name(), err))
+		} else if err != nil {
+			// unavailable sources do not block publishing
+			slog.Warn("Could not verify checkpoint", "verifier", v.Name(), "height", candidate.Height, "id", candidate.Id, "error", err)
+		}
+	}
+
+	if reason := b.Tripped(); reason != nil {
+		slog.Warn("Safe mode active, not publishing checkpoint", "height", candidate.Height, "id", candidate.Id, "reason", reason)
+		return false
+	}
+	return true
+}
+
+// ObserverVerifier Verifies candidates against the main chain view of a P2Pool observer API
+type ObserverVerifier struct {
+	urlFormat  string
+	httpClient *http.Client
+	timeout    time.Duration
+}
+
+// NewObserverVerifier urlFormat must contain a %d placeholder for the height, and return a JSON object with id and height fields
+func NewObserverVerifier(urlFormat string, client *http.Client, timeout time.Duration) *ObserverVerifier {
+	return &ObserverVerifier{
+		urlFormat:  urlFormat,
+		httpClient: client,
+		timeout:    timeout,
+	}
+}
+
+func (v *ObserverVerifier) Name() string {
+	return v.urlFormat
+}
+
+func (v *ObserverVerifier) Verify(ctx context.Context, candidate *BlockHeader) error {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(v.urlFormat, candidate.Height), nil)
+	if err != nil {
+		return err
+	}
+	r, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("observer returned non-200 status code: %d", r.StatusCode)
+	}
+
+	var block struct {
+		Id     types.Hash `json:"id"`
+		Height uint64     `json:"height"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&block); err != nil {
+		return err
+	}
+	if block.Height != candidate.Height || block.Id == types.ZeroHash {
+		return fmt.Errorf("observer returned block at height %d, expected %d", block.Height, candidate.Height)
+	}
+	if block.Id != candidate.Id {
+		return fmt.Errorf("%w: block at height %d is %s, expected %s", ErrDivergence, candidate.Height, block.Id, candidate.Id)
+	}
+	return nil
+}
@@ -10,16 +10,23 @@ import (
 	"os"
 	"time"
 
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/tracing"
 	"git.gammaspectra.live/P2Pool/monero-highway/internal/utils"
 	"github.com/cloudflare/cloudflare-go/v6"
 	"github.com/cloudflare/cloudflare-go/v6/dns"
 	"github.com/cloudflare/cloudflare-go/v6/option"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"golang.org/x/net/proxy"
 )
 
 var cloudflareApiKey string
 
+var tracer = otel.Tracer("git.gammaspectra.live/P2Pool/monero-highway/cmd/cloudflare-txt")
+
 func init() {
 	apiKey, ok := os.LookupEnv("CLOUDFLARE_API_TOKEN")
 	if !ok {
@@ -99,6 +106,7 @@ func main() {
 	proxyStr := flag.String("proxy", "", "URL to use as a proxy, example socks5://127.0.0.1:9050")
 	var recordSet utils.MultiStringFlag
 	flag.Var(&recordSet, "txt", "TXT record entry, unquoted. Can be specified multiple times")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP collector URL to export a trace of the update to, for example http://127.0.0.1:4318. Alternatively, use OTEL_EXPORTER_OTLP_ENDPOINT environment variable. Default empty, disabled")
 
 	flag.Parse()
 
@@ -123,10 +131,27 @@ func main() {
 		}
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), "cloudflare-txt", *otlpEndpoint)
+	if err != nil {
+		panic(fmt.Errorf("failed to set up tracing: %s", err))
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
 
-	err := sendCloudflare(dialer, ctx, *zoneId, *name, *ttl, recordSet)
+	ctx, span := tracer.Start(ctx, "cloudflare.send", trace.WithAttributes(
+		attribute.String("dns.name", *name),
+		attribute.Int("dns.records", len(recordSet)),
+	))
+	err = sendCloudflare(dialer, ctx, *zoneId, *name, *ttl, recordSet)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	// flush before exiting, panic skips deferred calls
+	_ = shutdownTracing(context.Background())
+
 	if err != nil {
 		panic(fmt.Errorf("failed to set cloudflare records: %s", err))
 	}
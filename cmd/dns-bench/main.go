@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type QueryWeight struct {
+	Type   uint16
+	Weight int
+}
+
+func parseMix(mix string) (result []QueryWeight, err error) {
+	for _, entry := range strings.Split(mix, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, weightStr, ok := strings.Cut(entry, ":")
+		if !ok {
+			weightStr = "1"
+		}
+		qtype, ok := dns.StringToType[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown query type %s", name)
+		}
+		weight, err := strconv.Atoi(weightStr)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight for %s: %s", name, weightStr)
+		}
+		if weight == 0 {
+			continue
+		}
+		result = append(result, QueryWeight{Type: qtype, Weight: weight})
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("empty query mix")
+	}
+	return result, nil
+}
+
+type Result struct {
+	Type     uint16
+	Duration time.Duration
+	Rcode    int
+	Err      error
+}
+
+func query(server, zone string, qtype uint16, do bool, udpSize uint16, timeout time.Duration) (rcode int, err error) {
+	var msg dns.Msg
+	if qtype == dns.TypeAXFR {
+		msg.SetAxfr(zone)
+	} else {
+		msg.SetQuestion(zone, qtype)
+	}
+	msg.SetEdns0(udpSize, do)
+
+	if qtype == dns.TypeAXFR || qtype == dns.TypeIXFR {
+		t := &dns.Transfer{
+			DialTimeout:  timeout,
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+		}
+		env, err := t.In(&msg, server)
+		if err != nil {
+			return -1, err
+		}
+		for e := range env {
+			if e.Error != nil {
+				err = e.Error
+			}
+		}
+		if err != nil {
+			return -1, err
+		}
+		return dns.RcodeSuccess, nil
+	}
+
+	client := &dns.Client{
+		Net:     "udp",
+		UDPSize: udpSize,
+		Timeout: timeout,
+	}
+	resp, _, err := client.Exchange(&msg, server)
+	if err != nil {
+		return -1, err
+	}
+	if resp.Truncated {
+		// fallback to TCP, as a resolver would
+		client.Net = "tcp"
+		resp, _, err = client.Exchange(&msg, server)
+		if err != nil {
+			return -1, err
+		}
+	}
+	return resp.Rcode, nil
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+func main() {
+	server := flag.String("server", "127.0.0.1:15353", "target DNS server address with port")
+	zone := flag.String("zone", "checkpoints.example.com.", "domain zone to query")
+	mix := flag.String("mix", "TXT:90,DNSKEY:9,AXFR:1", "comma separated mixture of query types and relative weights")
+	duration := flag.Duration("duration", time.Second*10, "duration of the benchmark")
+	concurrency := flag.Int("concurrency", 16, "number of concurrent clients")
+	timeout := flag.Duration("timeout", time.Second*2, "timeout for each query")
+	do := flag.Bool("dnssec", true, "set the DO bit on queries")
+	udpSize := flag.Uint("udp-size", 1232, "EDNS UDP buffer size to advertise")
+
+	flag.Parse()
+
+	if !strings.HasSuffix(*zone, ".") {
+		*zone += "."
+	}
+
+	weights, err := parseMix(*mix)
+	if err != nil {
+		slog.Error("Invalid query mix", "error", err)
+		panic(err)
+	}
+	var totalWeight int
+	for _, w := range weights {
+		totalWeight += w.Weight
+	}
+
+	pick := func() uint16 {
+		n := rand.IntN(totalWeight)
+		for _, w := range weights {
+			if n < w.Weight {
+				return w.Type
+			}
+			n -= w.Weight
+		}
+		return weights[len(weights)-1].Type
+	}
+
+	slog.Info("Starting benchmark", "server", *server, "zone", *zone, "mix", *mix, "duration", *duration, "concurrency", *concurrency)
+
+	deadline := time.Now().Add(*duration)
+	results := make([][]Result, max(1, *concurrency))
+
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				qtype := pick()
+				start := time.Now()
+				rcode, err := query(*server, *zone, qtype, *do, uint16(*udpSize), *timeout)
+				results[i] = append(results[i], Result{
+					Type:     qtype,
+					Duration: time.Since(start),
+					Rcode:    rcode,
+					Err:      err,
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	type Stats struct {
+		Durations []time.Duration
+		Errors    int
+		Rcodes    map[int]int
+	}
+	stats := make(map[uint16]*Stats)
+	total := &Stats{Rcodes: make(map[int]int)}
+	for _, w := range weights {
+		stats[w.Type] = &Stats{Rcodes: make(map[int]int)}
+	}
+
+	for _, worker := range results {
+		for _, r := range worker {
+			for _, s := range []*Stats{stats[r.Type], total} {
+				if r.Err != nil {
+					s.Errors++
+					continue
+				}
+				s.Durations = append(s.Durations, r.Duration)
+				s.Rcodes[r.Rcode]++
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TYPE\tQUERIES\tQPS\tERRORS\tP50\tP90\tP99\tMAX\tRCODES")
+	printStats := func(name string, s *Stats) {
+		slices.Sort(s.Durations)
+		var rcodes []string
+		for rcode, n := range s.Rcodes {
+			rcodes = append(rcodes, fmt.Sprintf("%s=%d", dns.RcodeToString[rcode], n))
+		}
+		slices.Sort(rcodes)
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%.1f\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			name,
+			len(s.Durations)+s.Errors,
+			float64(len(s.Durations))/duration.Seconds(),
+			s.Errors,
+			percentile(s.Durations, 0.5),
+			percentile(s.Durations, 0.9),
+			percentile(s.Durations, 0.99),
+			percentile(s.Durations, 1),
+			strings.Join(rcodes, ","),
+		)
+	}
+	for _, w := range weights {
+		printStats(dns.TypeToString[w.Type], stats[w.Type])
+	}
+	printStats("TOTAL", total)
+	_ = tw.Flush()
+}
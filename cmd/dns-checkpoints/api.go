@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Error codes returned by the HTTP API. These are stable and can be matched by clients
+const (
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeInvalidTTL       = "invalid_ttl"
+	ErrorCodeNoRecords        = "no_records"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeInternal         = "internal"
+	ErrorCodeNotReady         = "not_ready"
+	ErrorCodeInvalidRange     = "invalid_range"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeQueueFull        = "queue_full"
+	ErrorCodeTimeout          = "timeout"
+	ErrorCodeLeaseHeld        = "lease_held"
+	ErrorCodeInvalidHolder    = "invalid_holder"
+)
+
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestId string `json:"request_id"`
+	// Temporary Whether the request can be retried as-is
+	Temporary bool `json:"temporary"`
+}
+
+// RecordResponse A TXT record at the zone apex, as returned by the records endpoint
+type RecordResponse struct {
+	Txt string `json:"txt"`
+	TTL uint32 `json:"ttl"`
+	// Provenance Source that added the record. Missing if unknown
+	Provenance *RecordProvenance `json:"provenance,omitempty"`
+}
+
+// ReadyResponse Returned by the readiness endpoint once the zone is signed and served
+type ReadyResponse struct {
+	Ready  bool   `json:"ready"`
+	Serial uint32 `json:"serial"`
+}
+
+const RequestIdHeader = "X-Request-Id"
+
+type requestIdKey struct{}
+
+type tokenIdKey struct{}
+
+var tracer = otel.Tracer("git.gammaspectra.live/P2Pool/monero-highway/cmd/dns-checkpoints")
+
+// statusWriter Records the status code written to a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap Allows http.ResponseController to reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// TraceHandler Starts a span for each request, continuing the trace of the client if it sent a traceparent header
+func TraceHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(tracing.Extract(r.Context(), r.Header), r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", r.RemoteAddr),
+			),
+		)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", sw.status),
+			attribute.String("http.request.id", w.Header().Get(RequestIdHeader)),
+		)
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// RequestIdHandler Assigns a correlation id to each request, reusing one set by the client
+func RequestIdHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIdHeader)
+		if id == "" || len(id) > 64 {
+			var buf [8]byte
+			_, _ = rand.Read(buf[:])
+			id = hex.EncodeToString(buf[:])
+		}
+		w.Header().Set(RequestIdHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdKey{}, id)))
+	})
+}
+
+// AuthHandler Requires a bearer token on all requests. An empty token disables authentication
+func AuthHandler(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	tokenId := TokenId(token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			writeAPIError(w, r, http.StatusUnauthorized, ErrorCodeUnauthorized, "Unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenIdKey{}, tokenId)))
+	})
+}
+
+// TokenId Returns a short identifier of an API token, safe to log and store
+func TokenId(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:4])
+}
+
+// RequestTokenId Returns the id of the token the request was authenticated with, or empty
+func RequestTokenId(r *http.Request) string {
+	id, _ := r.Context().Value(tokenIdKey{}).(string)
+	return id
+}
+
+func RequestId(r *http.Request) string {
+	id, _ := r.Context().Value(requestIdKey{}).(string)
+	return id
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	apiErr := APIError{
+		Code:      code,
+		Message:   message,
+		RequestId: RequestId(r),
+		Temporary: status >= http.StatusInternalServerError || status == http.StatusTooManyRequests,
+	}
+	slog.Warn("API request failed", "request_id", apiErr.RequestId, "remote", r.RemoteAddr, "status", status, "code", code, "message", message)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apiErr)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveEntry A checkpoint record that was published, with the secondaries that acknowledged a serial including it
+type ArchiveEntry struct {
+	Height uint64 `json:"height"`
+	Id     string `json:"id"`
+
+	PublishedAt time.Time `json:"published_at"`
+	// Serial SOA serial the checkpoint was first published with
+	Serial uint32 `json:"serial"`
+
+	Acks []ArchiveAck `json:"acks,omitempty"`
+}
+
+// ArchiveAck A NOTIFY for a serial including the checkpoint was answered successfully by Server
+type ArchiveAck struct {
+	Server string    `json:"server"`
+	Time   time.Time `json:"time"`
+	Serial uint32    `json:"serial"`
+}
+
+const (
+	archiveLinePublish = "publish"
+	archiveLineAck     = "ack"
+)
+
+// archiveLine A single line of the archive file. Entries are rebuilt by replaying all lines
+type archiveLine struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Height uint64    `json:"height"`
+	Id     string    `json:"id"`
+	Serial uint32    `json:"serial"`
+	Server string    `json:"server,omitempty"`
+}
+
+type archiveKey struct {
+	height uint64
+	id     string
+}
+
+// Archive Retains every checkpoint ever published, persisted as an append-only JSON lines file
+type Archive struct {
+	lock sync.RWMutex
+
+	f       *os.File
+	entries map[archiveKey]*ArchiveEntry
+	// sorted Entries by ascending height
+	sorted []*ArchiveEntry
+}
+
+// OpenArchive Opens or creates the archive at path and replays it.
+// An incomplete or invalid last line, as left by a crash mid-write, is truncated away
+func OpenArchive(path string) (*Archive, error) {
+	a := &Archive{
+		entries: make(map[archiveKey]*ArchiveEntry),
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(f)
+	// offset End of the last complete line
+	var offset int64
+	for n := 1; ; n++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(data) == 0 {
+			break
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			_ = f.Close()
+			return nil, err
+		}
+
+		var line archiveLine
+		if err == nil {
+			err = json.Unmarshal(data, &line)
+		} else {
+			err = errors.New("missing newline")
+		}
+		if err != nil {
+			if _, peekErr := reader.Peek(1); !errors.Is(peekErr, io.EOF) {
+				_ = f.Close()
+				return nil, fmt.Errorf("archive line %d: %w", n, err)
+			}
+			slog.Warn("Truncating incomplete last archive line", "path", path, "line", n, "error", err)
+			if err = f.Truncate(offset); err != nil {
+				_ = f.Close()
+				return nil, err
+			}
+			break
+		}
+		a.apply(line)
+		offset += int64(len(data))
+	}
+	a.f = f
+	return a, nil
+}
+
+// ParseCheckpointRecord Parses a height:id TXT record. Other records, like metadata, return false
+func ParseCheckpointRecord(record string) (height uint64, id string, ok bool) {
+	heightStr, id, found := strings.Cut(record, ":")
+	if !found {
+		return 0, "", false
+	}
+	height, err := strconv.ParseUint(heightStr, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	if buf, err := hex.DecodeString(id); err != nil || len(buf) != 32 {
+		return 0, "", false
+	}
+	return height, strings.ToLower(id), true
+}
+
+// changes Whether applying line would change the entries
+func (a *Archive) changes(line archiveLine) bool {
+	entry, ok := a.entries[archiveKey{height: line.Height, id: line.Id}]
+	switch line.Type {
+	case archiveLinePublish:
+		return !ok
+	case archiveLineAck:
+		return ok && !slices.ContainsFunc(entry.Acks, func(ack ArchiveAck) bool {
+			return ack.Server == line.Server
+		})
+	}
+	return false
+}
+
+func (a *Archive) apply(line archiveLine) {
+	if !a.changes(line) {
+		return
+	}
+	key := archiveKey{height: line.Height, id: line.Id}
+	switch line.Type {
+	case archiveLinePublish:
+		entry := &ArchiveEntry{
+			Height:      line.Height,
+			Id:          line.Id,
+			PublishedAt: line.Time,
+			Serial:      line.Serial,
+		}
+		a.entries[key] = entry
+		i, _ := slices.BinarySearchFunc(a.sorted, entry, func(e, t *ArchiveEntry) int {
+			return cmp.Or(cmp.Compare(e.Height, t.Height), cmp.Compare(e.Id, t.Id))
+		})
+		a.sorted = slices.Insert(a.sorted, i, entry)
+	case archiveLineAck:
+		entry := a.entries[key]
+		entry.Acks = append(entry.Acks, ArchiveAck{
+			Server: line.Server,
+			Time:   line.Time,
+			Serial: line.Serial,
+		})
+	}
+}
+
+// commit Appends the lines that change the entries to the file, then applies them.
+// Entries are left untouched when writing fails
+func (a *Archive) commit(lines []archiveLine) error {
+	var changed []archiveLine
+	for _, line := range lines {
+		if a.changes(line) && !slices.ContainsFunc(changed, func(l archiveLine) bool {
+			return l.Height == line.Height && l.Id == line.Id
+		}) {
+			changed = append(changed, line)
+		}
+	}
+	if err := a.write(changed); err != nil {
+		return err
+	}
+	for _, line := range changed {
+		a.apply(line)
+	}
+	return nil
+}
+
+func (a *Archive) write(lines []archiveLine) error {
+	var buf []byte
+	for _, line := range lines {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	if _, err := a.f.Write(buf); err != nil {
+		return err
+	}
+	return a.f.Sync()
+}
+
+// Publish Archives the checkpoint records not seen before, published with serial
+func (a *Archive) Publish(records []string, serial uint32, now time.Time) error {
+	if a == nil {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var lines []archiveLine
+	for _, record := range records {
+		height, id, ok := ParseCheckpointRecord(record)
+		if !ok {
+			continue
+		}
+		line := archiveLine{
+			Type:   archiveLinePublish,
+			Time:   now,
+			Height: height,
+			Id:     id,
+			Serial: serial,
+		}
+		lines = append(lines, line)
+	}
+	return a.commit(lines)
+}
+
+// Ack Records server acknowledged serial, which contained the checkpoint records
+func (a *Archive) Ack(server string, records []string, serial uint32, now time.Time) error {
+	if a == nil {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var lines []archiveLine
+	for _, record := range records {
+		height, id, ok := ParseCheckpointRecord(record)
+		if !ok {
+			continue
+		}
+		line := archiveLine{
+			Type:   archiveLineAck,
+			Time:   now,
+			Height: height,
+			Id:     id,
+			Serial: serial,
+			Server: server,
+		}
+		lines = append(lines, line)
+	}
+	return a.commit(lines)
+}
+
+// Range Returns up to limit archived checkpoints with height within [from, to], by ascending height
+func (a *Archive) Range(from, to uint64, limit int) []ArchiveEntry {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	i, _ := slices.BinarySearchFunc(a.sorted, from, func(e *ArchiveEntry, height uint64) int {
+		// first entry at from height
+		return cmp.Or(cmp.Compare(e.Height, height), 1)
+	})
+	result := make([]ArchiveEntry, 0)
+	for ; i < len(a.sorted) && a.sorted[i].Height <= to && len(result) < limit; i++ {
+		entry := *a.sorted[i]
+		entry.Acks = slices.Clone(entry.Acks)
+		result = append(result, entry)
+	}
+	return result
+}
+
+func (a *Archive) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.f.Close()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	AuditEventPush       = "push"
+	AuditEventResign     = "resign"
+	AuditEventZoneChange = "zone_change"
+	AuditEventLease      = "lease_acquire"
+	AuditEventRelease    = "lease_release"
+)
+
+// AuditEvent A single line of the audit log
+type AuditEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+
+	// RequestId Correlation id of the API request, if any
+	RequestId string `json:"request_id,omitempty"`
+	// Remote Address of the API client
+	Remote string `json:"remote,omitempty"`
+	// TokenId Identifies the API token used, if authentication is enabled
+	TokenId string `json:"token_id,omitempty"`
+	// Holder Publisher lease holder, on lease events
+	Holder string `json:"holder,omitempty"`
+
+	Type    string   `json:"type,omitempty"`
+	TTL     uint32   `json:"ttl,omitempty"`
+	Records []string `json:"records,omitempty"`
+
+	// OldSerial SOA serial before a zone change
+	OldSerial uint32 `json:"old_serial,omitempty"`
+	// NewSerial SOA serial after a zone change
+	NewSerial uint32 `json:"new_serial,omitempty"`
+}
+
+// WithRecords Fills the record fields of the event from a record set
+func (e AuditEvent) WithRecords(rr []dns.RR) AuditEvent {
+	if len(rr) == 0 {
+		return e
+	}
+	e.Type = dns.TypeToString[rr[0].Header().Rrtype]
+	e.TTL = rr[0].Header().Ttl
+	for _, r := range rr {
+		if txt, ok := r.(*dns.TXT); ok {
+			e.Records = append(e.Records, txt.Txt...)
+		} else {
+			e.Records = append(e.Records, r.String())
+		}
+	}
+	return e
+}
+
+// AuditLog Append-only JSON lines log, rotated once it exceeds maxSize bytes or maxAge since opened.
+// Rotated files are kept next to it with a timestamp suffix. A nil AuditLog discards all events
+type AuditLog struct {
+	lock sync.Mutex
+
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func OpenAuditLog(path string, maxSize int64, maxAge time.Duration) (*AuditLog, error) {
+	a := &AuditLog{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AuditLog) open() error {
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	a.f = f
+	a.size = stat.Size()
+	a.opened = time.Now()
+	return nil
+}
+
+// rotate Moves the current file aside and opens a new one. On failure the current file is reopened, so events keep being written
+func (a *AuditLog) rotate() error {
+	rotated := fmt.Sprintf("%s.%s", a.path, time.Now().UTC().Format("20060102T150405.000000000Z"))
+	err := a.f.Close()
+	if err == nil {
+		if err = os.Rename(a.path, rotated); err == nil {
+			if err = a.open(); err == nil {
+				return nil
+			}
+			_ = os.Rename(rotated, a.path)
+		}
+	}
+	opened := a.opened
+	if reopenErr := a.open(); reopenErr != nil {
+		return errors.Join(err, reopenErr)
+	}
+	// rotate again on the next event
+	a.opened = opened
+	return err
+}
+
+// Write Appends the event, rotating the file beforehand if needed
+func (a *AuditLog) Write(event AuditEvent) error {
+	if a == nil {
+		return nil
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var rotateErr error
+	if a.size > 0 && ((a.maxSize > 0 && a.size+int64(len(line)) > a.maxSize) || (a.maxAge > 0 && time.Since(a.opened) >= a.maxAge)) {
+		// still write the event to the current file, rotation is retried on the next one
+		rotateErr = a.rotate()
+	}
+
+	n, err := a.f.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return errors.Join(rotateErr, err)
+	}
+	return errors.Join(rotateErr, a.f.Sync())
+}
+
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.f.Close()
+}
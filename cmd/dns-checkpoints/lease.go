@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Lease Publisher lease over the zone records. While held, only its holder may push records
+type Lease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+	// Term Incremented each time the lease is acquired by a different holder
+	Term uint64 `json:"term"`
+	// TTL Seconds the lease was last granted for, after capping the requested ttl
+	TTL uint32 `json:"ttl"`
+}
+
+// LeaseManager Grants the publisher lease to one checkpointer at a time, so redundant instances do not race each other.
+// Leases are kept in memory only, after a restart the first holder to renew acquires it again
+type LeaseManager struct {
+	lock    sync.Mutex
+	current Lease
+}
+
+func NewLeaseManager() *LeaseManager {
+	return &LeaseManager{}
+}
+
+// Acquire Grants or renews the lease to holder for ttl. If held by someone else, returns the current lease and false.
+// acquired is set unless this renews a lease still held by holder
+func (m *LeaseManager) Acquire(holder string, ttl time.Duration, now time.Time) (lease Lease, ok, acquired bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	held := now.Before(m.current.Expires)
+	if m.current.Holder != holder && held {
+		return m.current, false, false
+	}
+	if m.current.Holder != holder {
+		m.current.Holder = holder
+		m.current.Term++
+	}
+	m.current.Expires = now.Add(ttl)
+	m.current.TTL = uint32(ttl / time.Second)
+	return m.current, true, !held
+}
+
+// Release Gives up the lease if held by holder
+func (m *LeaseManager) Release(holder string, now time.Time) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.current.Holder != holder || !now.Before(m.current.Expires) {
+		return false
+	}
+	m.current.Expires = now
+	return true
+}
+
+// Current Returns the lease, if held
+func (m *LeaseManager) Current(now time.Time) (Lease, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.current, now.Before(m.current.Expires)
+}
+
+// Allows Whether holder may push records at now: the lease is held by holder, or not held at all
+func (m *LeaseManager) Allows(holder string, now time.Time) bool {
+	lease, held := m.Current(now)
+	return !held || lease.Holder == holder
+}
@@ -11,23 +11,36 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/atomicfile"
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/migrate"
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/tracing"
 	"git.gammaspectra.live/P2Pool/monero-highway/internal/utils"
+	"git.gammaspectra.live/P2Pool/monero-highway/pkg/dnssigner"
 	"github.com/miekg/dns"
 )
 
 func main() {
-	opts := DefaultSignerOptions()
+	opts := dnssigner.DefaultSignerOptions()
 
 	apiBind := flag.String("api-bind", "127.0.0.1:19080", "address to bind the HTTP API")
+	apiToken := flag.String("api-token", os.Getenv("MONERO_HIGHWAY_API_TOKEN"), "bearer token required on all HTTP API requests. Alternatively, use MONERO_HIGHWAY_API_TOKEN environment variable. Default empty, no authentication")
+	apiMinTTL := flag.Duration("api-min-ttl", time.Second*30, "minimum TTL allowed via the ttl parameter of the HTTP API, with seconds granularity")
+	apiMaxTTL := flag.Duration("api-max-ttl", time.Hour, "maximum TTL allowed via the ttl parameter of the HTTP API, with seconds granularity")
+	leaseMaxTTL := flag.Duration("lease-max-ttl", time.Minute*5, "maximum duration of the publisher lease requested via /lease on the HTTP API, with seconds granularity")
 
 	bind := flag.String("bind", "0.0.0.0:15353", "address to bind DNS server to, UDP and TCP")
 	flag.DurationVar(&opts.RecordTTL, "ttl", opts.RecordTTL, "TTL to set on responses, with seconds granularity")
@@ -35,24 +48,107 @@ func main() {
 
 	flag.StringVar(&opts.Zone, "zone", opts.Zone, "domain zone to reply for")
 	//TODO: multiple
-	var nsValues utils.MultiStringFlag
-	flag.Var(&nsValues, "ns", "nameservers for the zone. Can be specified multiple times")
+	nsValues := utils.ListFlag{Validate: utils.ValidateDomainName}
+	flag.Var(&nsValues, "ns", "nameservers for the zone. Can be specified multiple times, or comma separated")
 	flag.StringVar(&opts.Mailbox, "mailbox", opts.Mailbox, "mailbox for the zone SOA record")
+	flag.BoolVar(&opts.Wildcard, "wildcard", opts.Wildcard, "also answer TXT queries for any name below the zone, via a DNSSEC signed *.zone wildcard record")
+	flag.IntVar(&opts.QueueSize, "queue-size", opts.QueueSize, "number of record updates that can wait to be signed")
+	flag.DurationVar(&opts.QueueTimeout, "queue-timeout", opts.QueueTimeout, "time an API push waits for space in a full signing queue before failing with queue_full")
 	keyType := flag.String("generate-key-type", "ed25519", "type of key to generate, allowed values (ed25519, secp256r1, secp384r1, rsa2048, rsa4096)")
 	keyFile := flag.String("key", os.Getenv("MONERO_HIGHWAY_KEY"), "DER/PEM encoded private key. Alternatively, use MONERO_HIGHWAY_KEY environment variable")
 
-	var axfrNotify utils.MultiStringFlag
+	axfrNotify := utils.ListFlag{Validate: utils.ValidateHostPort}
 	axfr := flag.Bool("axfr", false, "allow zone transfers via AXFR TCP transfers")
 	flag.Var(&axfrNotify, "axfr-notify", "servers or addresses with defined port to NOTIFY for a desired AXFR transfer")
+	axfrMaxConcurrent := flag.Int("axfr-max-concurrent", 4, "maximum number of zone transfers served concurrently. Additional transfers are refused")
+	axfrInterval := flag.Duration("axfr-interval", time.Second, "minimum interval between zone transfers from the same client address. Set to 0 to disable")
+
+	truncation := dnssigner.DefaultTruncationPolicy()
+	udpMaxSize := flag.Uint("udp-max-size", 0, "maximum UDP response size, even if clients advertise a larger EDNS size. Larger responses are truncated. Default zero, use the client size")
+	udpAdvertiseSize := flag.Uint("udp-advertise-size", uint(truncation.AdvertiseSize), "EDNS UDP size to advertise on responses")
+	flag.BoolVar(&truncation.Minimal, "udp-minimal", truncation.Minimal, "drop additional, then authority records from UDP responses that do not fit, before truncating the answer. Dropping DNSSEC proofs sets TC")
+	flag.BoolVar(&truncation.KeepAuthority, "udp-truncated-authority", truncation.KeepAuthority, "keep authority records (SOA / NSEC) in truncated UDP responses, if they fit")
+	udp4MaxSize := flag.Uint("udp4-max-size", 0, "maximum UDP response size for IPv4 clients, overrides -udp-max-size. Default zero, use -udp-max-size")
+	udp4AdvertiseSize := flag.Uint("udp4-advertise-size", 0, "EDNS UDP size to advertise to IPv4 clients, overrides -udp-advertise-size. Default zero, use -udp-advertise-size")
+	udp6MaxSize := flag.Uint("udp6-max-size", 0, "maximum UDP response size for IPv6 clients, overrides -udp-max-size. Default zero, use -udp-max-size")
+	udp6AdvertiseSize := flag.Uint("udp6-advertise-size", 0, "EDNS UDP size to advertise to IPv6 clients, overrides -udp-advertise-size. Default zero, use -udp-advertise-size")
+	udp4Fragment := flag.String("udp4-fragment", "default", "IPv4 fragmentation of UDP responses, allowed values (default, omit-pmtu, never). Linux only")
+	udp6Fragment := flag.String("udp6-fragment", "default", "IPv6 fragmentation of UDP responses, allowed values (default, omit-pmtu, never). Linux only")
+
+	resolverBind := flag.String("resolver-bind", "", "loopback address to answer recursive queries on, UDP and TCP, for a co-located monerod. Only the zone is answered, other queries are refused. Default empty, disabled")
+	resolverUpstream := flag.String("resolver-upstream", "", "resolver (host:port, TCP) to forward DNSSEC chain of trust queries for the zone ancestors to, via -resolver-bind. Default empty, refuse them")
+
+	notReadyRcode := flag.String("not-ready-rcode", "SERVFAIL", "response code for queries received before the zone is fully signed on startup, allowed values (SERVFAIL, REFUSED)")
 
 	state := flag.String("state", "", "state file to preserve set TXT records to load on startup. A temporary file will be created next to it.")
 
+	auditLogPath := flag.String("audit-log", "", "file to append JSON lines audit events of API pushes and zone changes to. Default empty, disabled")
+	auditLogMaxSize := flag.Int64("audit-log-max-size", 64*1024*1024, "size in bytes after which the audit log is rotated. Set to 0 to disable")
+	auditLogMaxAge := flag.Duration("audit-log-max-age", time.Hour*24*7, "time after which the audit log is rotated. Set to 0 to disable")
+
+	archivePath := flag.String("archive", "", "file to retain every published checkpoint record with its serial and NOTIFY acknowledgements, queryable via /archive on the HTTP API. Default empty, disabled")
+
+	checkMigrations := flag.Bool("check-migrations", false, "report the version of -state and the migrations it needs, then exit without writing. Exits with status 1 if it cannot be migrated. Older versions are migrated automatically on startup")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP collector URL to export traces of DNS queries, record signing and HTTP API requests to, for example http://127.0.0.1:4318. Alternatively, use OTEL_EXPORTER_OTLP_ENDPOINT environment variable. Default empty, disabled")
+
 	flag.Parse()
 
+	truncation.MaxSize = uint16(min(*udpMaxSize, math.MaxUint16))
+	truncation.AdvertiseSize = uint16(min(max(*udpAdvertiseSize, dns.MinMsgSize), math.MaxUint16))
+	truncation.IPv4.MaxSize = uint16(min(*udp4MaxSize, math.MaxUint16))
+	truncation.IPv6.MaxSize = uint16(min(*udp6MaxSize, math.MaxUint16))
+	if *udp4AdvertiseSize > 0 {
+		truncation.IPv4.AdvertiseSize = uint16(min(max(*udp4AdvertiseSize, dns.MinMsgSize), math.MaxUint16))
+	}
+	if *udp6AdvertiseSize > 0 {
+		truncation.IPv6.AdvertiseSize = uint16(min(max(*udp6AdvertiseSize, dns.MinMsgSize), math.MaxUint16))
+	}
+
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level: slog.LevelDebug,
 	})))
 
+	if *checkMigrations {
+		if *state != "" && !stateSchema.Report(*state) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	var fragment dnssigner.FragmentPolicy
+	var err error
+	if fragment.IPv4, err = dnssigner.ParseFragmentMode(*udp4Fragment); err != nil {
+		slog.Error("Invalid -udp4-fragment", "error", err)
+		panic(err)
+	}
+	if fragment.IPv6, err = dnssigner.ParseFragmentMode(*udp6Fragment); err != nil {
+		slog.Error("Invalid -udp6-fragment", "error", err)
+		panic(err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "dns-checkpoints", *otlpEndpoint)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	var notReady int
+	switch strings.ToUpper(*notReadyRcode) {
+	case "SERVFAIL":
+		notReady = dns.RcodeServerFailure
+	case "REFUSED":
+		notReady = dns.RcodeRefused
+	default:
+		slog.Error("Unknown -not-ready-rcode", "rcode", *notReadyRcode)
+		panic("unknown not ready rcode")
+	}
+
+	if *apiMinTTL > *apiMaxTTL {
+		slog.Error("-api-min-ttl must not be greater than -api-max-ttl", "min", *apiMinTTL, "max", *apiMaxTTL)
+		panic("invalid api ttl bounds")
+	}
+
 	if !strings.HasSuffix(opts.Zone, ".") {
 		slog.Warn("-domain does not end with . suffix, adding", "domain", opts.Zone)
 		opts.Zone += "."
@@ -63,7 +159,7 @@ func main() {
 		opts.Mailbox += "."
 	}
 
-	for i, ns := range nsValues {
+	for i, ns := range nsValues.Values {
 		if !strings.HasSuffix(ns, ".") {
 			slog.Warn("-ns does not end with . suffix, adding", "index", i, "ns", ns)
 			ns += "."
@@ -162,12 +258,54 @@ func main() {
 		slog.Info("Loaded private key from file")
 	}
 
-	signer, err := NewSigner(slog.Default(), opts)
+	signer, err := dnssigner.NewSigner(slog.Default(), opts)
 	if err != nil {
 		slog.Error("Failed to create signer", "error", err)
 		panic(err)
 	}
 
+	var auditLog *AuditLog
+	if *auditLogPath != "" {
+		auditLog, err = OpenAuditLog(*auditLogPath, *auditLogMaxSize, *auditLogMaxAge)
+		if err != nil {
+			slog.Error("Failed to open audit log", "error", err)
+			panic(err)
+		}
+		defer auditLog.Close()
+	}
+
+	var archive *Archive
+	if *archivePath != "" {
+		archive, err = OpenArchive(*archivePath)
+		if err != nil {
+			slog.Error("Failed to open archive", "error", err)
+			panic(err)
+		}
+		defer archive.Close()
+	}
+
+	provenance := NewProvenanceTracker()
+
+	signer.OnChange(func(change dnssigner.ZoneChange) {
+		event := AuditEvent{
+			Event:     AuditEventZoneChange,
+			Type:      dns.TypeToString[change.Type],
+			OldSerial: change.OldSerial,
+			NewSerial: change.NewSerial,
+		}.WithRecords(change.RR)
+		if err := auditLog.Write(event); err != nil {
+			slog.Error("Failed to write audit log", "error", err)
+		}
+		if change.Type == dns.TypeTXT && dns.CanonicalName(change.Name) == dns.CanonicalName(signer.Zone()) {
+			// applied in signing order, so concurrent pushes cannot leave provenance of a superseded RRset
+			p, _ := ProvenanceFromContext(change.Context)
+			provenance.Replace(event.Records, p)
+			if err := archive.Publish(event.Records, change.NewSerial, time.Now()); err != nil {
+				slog.Error("Failed to write archive", "error", err)
+			}
+		}
+	})
+
 	slog.Info("DNSKEY ZSK", "record", strings.ReplaceAll(signer.DNSKEY()[0].String(), "\t", " "))
 	slog.Info("DNSKEY KSK", "record", strings.ReplaceAll(signer.DNSKEY()[1].String(), "\t", " "))
 	slog.Info("DS KSK", "record", strings.ReplaceAll(signer.DS().String(), "\t", " "))
@@ -187,7 +325,7 @@ func main() {
 		}
 	}
 
-	if len(axfrNotify) > 0 {
+	if len(axfrNotify.Values) > 0 {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -203,7 +341,13 @@ func main() {
 					continue
 				}
 				msg.Answer = append(msg.Answer, soa.RR...)
-				for _, q := range axfrNotify {
+				serial := soa.RR[0].(*dns.SOA).Serial
+
+				var records []string
+				if txt := signer.Get(dns.TypeTXT); txt != nil {
+					records = AuditEvent{}.WithRecords(txt.RR).Records
+				}
+				for _, q := range axfrNotify.Values {
 					func() {
 						ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 						defer cancel()
@@ -217,6 +361,9 @@ func main() {
 							slog.Debug("Sent NOTIFY to server, received code", "server", q, "code", resp.Rcode)
 						} else {
 							slog.Debug("Sent NOTIFY to server success", "server", q, "code", resp.Rcode)
+							if err := archive.Ack(q, records, serial, time.Now()); err != nil {
+								slog.Error("Failed to write archive", "error", err)
+							}
 						}
 					}()
 
@@ -236,151 +383,250 @@ func main() {
 		}
 	}()
 
-	signer.AddAuthorityRecords()
-
 	var storeState = func(ts time.Time) {
 
 	}
 
-	if *state != "" {
-		stateData, err := os.ReadFile(*state)
-		if err != nil {
-			slog.Warn("Failed to read state file", "error", err)
-		} else {
-			var data []string
-			err = json.Unmarshal(stateData, &data)
-			if err != nil {
-				slog.Warn("Failed to unpack state file", "error", err)
-			} else {
-				var txt []dns.RR
+	// queries are answered with the not ready code until MarkReady below
+	serveOpts := dnssigner.DefaultServeOptions()
+	serveOpts.AXFR = *axfr
+	serveOpts.Transfers = dnssigner.NewTransferLimiter(*axfrMaxConcurrent, *axfrInterval)
+	serveOpts.Truncation = truncation
+	serveOpts.Fragment = fragment
+	serveOpts.UDPSize = udpBufferSize
+	serveOpts.NotReady = notReady
 
-				for _, entry := range data {
-					if len(entry) == 0 {
-						continue
-					}
-					txt = append(txt, &dns.TXT{
-						Hdr: dns.RR_Header{
-							Name:   signer.Zone(),
-							Rrtype: dns.TypeTXT,
-							Class:  dns.ClassINET,
-							Ttl:    TTL(opts.RecordTTL),
-						},
-						Txt: []string{entry},
-					})
-				}
+	//TODO: drop privileges if given root / port 53
 
-				signer.Add(txt...)
-				slog.Info("Loaded state file", "records", len(txt))
-			}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		slog.Info("Starting DNS server on UDP and TCP", "bind", *bind)
+		if err := dnssigner.Serve(context.Background(), signer, *bind, serveOpts); err != nil {
+			slog.Error("Failed to start DNS server", "bind", *bind, "error", err)
 		}
-		var stateMutex sync.Mutex
-		var lastTs time.Time
-		storeState = func(ts time.Time) {
-			stateMutex.Lock()
-			defer stateMutex.Unlock()
+	}()
 
-			// check origin of call
-			if lastTs.After(ts) {
-				return
-			}
-			lastTs = ts
+	if *resolverBind != "" {
+		if host, _, err := net.SplitHostPort(*resolverBind); err != nil || !net.ParseIP(host).IsLoopback() {
+			slog.Warn("-resolver-bind is not a loopback address, queries from other addresses are refused", "bind", *resolverBind)
+		}
 
-			records := signer.Get(dns.TypeTXT)
-			if records == nil {
-				return
-			}
-			var data []string
-			for _, rr := range records.RR {
-				if r, ok := rr.(*dns.TXT); ok {
-					data = append(data, r.Txt[0])
-				}
-			}
+		resolverOpts := serveOpts
+		resolverOpts.AXFR = false
+		resolverOpts.Wrap = dnssigner.NewResolver(signer, *resolverUpstream, time.Second*5).Wrap
 
-			stateData, err := json.MarshalIndent(data, "", " ")
-			if err != nil {
-				slog.Warn("Failed to encode state", "error", err)
-				return
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slog.Info("Starting resolver on UDP and TCP", "bind", *resolverBind, "upstream", *resolverUpstream)
+			if err := dnssigner.Serve(context.Background(), signer, *resolverBind, resolverOpts); err != nil {
+				slog.Error("Failed to start resolver", "bind", *resolverBind, "error", err)
 			}
+		}()
+	}
 
-			var perm os.FileMode = 0644
+	leases := NewLeaseManager()
 
-			if stat, err := os.Stat(*state); err == nil {
-				// preserve
-				perm = stat.Mode().Perm()
-			}
-			err = os.WriteFile(*state+"_", stateData, perm)
-			if err != nil {
-				slog.Warn("Failed to write state file", "error", err)
-				return
-			}
+	if *apiBind != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 
-			err = os.Rename(*state+"_", *state)
-			if err != nil {
-				slog.Warn("Failed to rename state file", "error", err)
-				return
-			}
-			slog.Debug("Saved state file")
-		}
-	}
+			slog.Info("Starting HTTP server", "bind", *apiBind)
 
-	// await for signatures
-	for {
-		if txt := signer.Get(dns.TypeNS); txt != nil {
-			break
-		}
-		time.Sleep(time.Millisecond * 10)
-	}
+			mux := http.NewServeMux()
 
-	dnsServerTCP := &dns.Server{
-		Addr:    *bind,
-		Net:     "tcp",
-		Handler: RequestHandler(signer, false, *axfr, udpBufferSize),
-	}
+			mux.Handle("/debug/vars", expvar.Handler())
 
-	dnsServerUDP := dns.Server{
-		Addr:    *bind,
-		Net:     "udp",
-		Handler: RequestHandler(signer, true, false, udpBufferSize),
-		UDPSize: udpBufferSize,
-	}
+			mux.HandleFunc("/archive", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "GET" {
+					writeAPIError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
+					return
+				}
+				if archive == nil {
+					writeAPIError(w, r, http.StatusNotFound, ErrorCodeNotFound, "Archive is not enabled")
+					return
+				}
 
-	//TODO: drop privileges if given root / port 53
+				values := r.URL.Query()
+				from, to, limit := uint64(0), uint64(math.MaxUint64), 1000
+				var err error
+				if v := values.Get("from"); v != "" {
+					from, err = strconv.ParseUint(v, 10, 64)
+				}
+				if v := values.Get("to"); v != "" && err == nil {
+					to, err = strconv.ParseUint(v, 10, 64)
+				}
+				if v := values.Get("limit"); v != "" && err == nil {
+					limit, err = strconv.Atoi(v)
+					limit = min(limit, 1000)
+				}
+				if err != nil || from > to || limit <= 0 {
+					writeAPIError(w, r, http.StatusBadRequest, ErrorCodeInvalidRange, "Invalid height range")
+					return
+				}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		slog.Info("Starting DNS server on TCP", "bind", dnsServerTCP.Addr)
-		if err := dnsServerTCP.ListenAndServe(); err != nil {
-			if err != nil {
-				slog.Error("Failed to start DNS server on TCP", "bind", dnsServerTCP.Addr, "error", err)
-			}
-		}
-	}()
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(archive.Range(from, to, limit))
+			})
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		slog.Info("Starting DNS server on UDP", "bind", dnsServerUDP.Addr)
-		if err := dnsServerUDP.ListenAndServe(); err != nil {
-			if err != nil {
-				slog.Error("Failed to start DNS server on UDP", "bind", dnsServerUDP.Addr, "error", err)
-			}
-		}
-	}()
+			mux.HandleFunc("/lease", func(w http.ResponseWriter, r *http.Request) {
+				now := time.Now()
+				holder := r.URL.Query().Get("holder")
+				if r.Method == "GET" {
+					lease, held := leases.Current(now)
+					if !held {
+						writeAPIError(w, r, http.StatusNotFound, ErrorCodeNotFound, "Lease is not held")
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(lease)
+					return
+				}
+				if r.Method != "POST" && r.Method != "DELETE" {
+					writeAPIError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
+					return
+				}
+				if holder == "" || len(holder) > 64 {
+					writeAPIError(w, r, http.StatusBadRequest, ErrorCodeInvalidHolder, "Invalid holder")
+					return
+				}
 
-	if *apiBind != "" {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
+				if r.Method == "DELETE" {
+					if !leases.Release(holder, now) {
+						writeAPIError(w, r, http.StatusConflict, ErrorCodeLeaseHeld, "Lease is not held by holder")
+						return
+					}
+					if err := auditLog.Write(AuditEvent{
+						Time:      now,
+						Event:     AuditEventRelease,
+						RequestId: RequestId(r),
+						Remote:    r.RemoteAddr,
+						TokenId:   RequestTokenId(r),
+						Holder:    holder,
+					}); err != nil {
+						slog.Error("Failed to write audit log", "error", err)
+					}
+					slog.Info("Publisher lease released", "holder", holder, "request_id", RequestId(r), "remote", r.RemoteAddr)
+					w.WriteHeader(http.StatusOK)
+					return
+				}
 
-			slog.Info("Starting HTTP server", "bind", *apiBind)
+				ttl := time.Second * 30
+				if ttlValue := r.URL.Query().Get("ttl"); ttlValue != "" {
+					seconds, err := strconv.ParseUint(ttlValue, 10, 32)
+					if err != nil || seconds == 0 {
+						writeAPIError(w, r, http.StatusBadRequest, ErrorCodeInvalidTTL, "Invalid ttl")
+						return
+					}
+					ttl = min(time.Duration(seconds)*time.Second, *leaseMaxTTL)
+				}
 
-			if err := http.ListenAndServe(*apiBind, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lease, ok, acquired := leases.Acquire(holder, ttl, now)
+				if !ok {
+					writeAPIError(w, r, http.StatusConflict, ErrorCodeLeaseHeld, fmt.Sprintf("Lease is held by %s until %s", lease.Holder, lease.Expires.UTC().Format(time.RFC3339)))
+					return
+				}
+				if acquired {
+					if err := auditLog.Write(AuditEvent{
+						Time:      now,
+						Event:     AuditEventLease,
+						RequestId: RequestId(r),
+						Remote:    r.RemoteAddr,
+						TokenId:   RequestTokenId(r),
+						Holder:    holder,
+					}); err != nil {
+						slog.Error("Failed to write audit log", "error", err)
+					}
+					slog.Info("Publisher lease acquired", "holder", holder, "term", lease.Term, "expires", lease.Expires, "request_id", RequestId(r), "remote", r.RemoteAddr)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(lease)
+			})
+
+			mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "GET" {
+					writeAPIError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
+					return
+				}
+				soa := signer.Get(dns.TypeSOA)
+				if !signer.Ready() || soa == nil {
+					writeAPIError(w, r, http.StatusServiceUnavailable, ErrorCodeNotReady, "Zone is not signed yet")
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(ReadyResponse{
+					Ready:  true,
+					Serial: soa.RR[0].(*dns.SOA).Serial,
+				})
+			})
+
+			mux.HandleFunc("/resign", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "POST" {
+					writeAPIError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
+					return
+				}
+				if !signer.Ready() {
+					writeAPIError(w, r, http.StatusServiceUnavailable, ErrorCodeNotReady, "Zone is not signed yet")
+					return
+				}
+				ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+				defer cancel()
+				if err := signer.Resign(ctx); errors.Is(err, dnssigner.ErrQueueFull) {
+					writeAPIError(w, r, http.StatusServiceUnavailable, ErrorCodeQueueFull, "Signing queue is full")
+					return
+				} else if err != nil {
+					writeAPIError(w, r, http.StatusServiceUnavailable, ErrorCodeTimeout, "Re-signing did not finish in time")
+					return
+				}
+				if err := auditLog.Write(AuditEvent{
+					Event:     AuditEventResign,
+					RequestId: RequestId(r),
+					Remote:    r.RemoteAddr,
+					TokenId:   RequestTokenId(r),
+				}); err != nil {
+					slog.Error("Failed to write audit log", "error", err)
+				}
+				slog.Info("Re-signed all records via API", "request_id", RequestId(r), "remote", r.RemoteAddr)
+				sendNotify()
+				w.WriteHeader(http.StatusOK)
+			})
+
+			mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "GET" {
+					result := make([]RecordResponse, 0)
+					if records := signer.Get(dns.TypeTXT); records != nil {
+						for _, rr := range records.RR {
+							if txt, ok := rr.(*dns.TXT); ok {
+								record := RecordResponse{
+									Txt: txt.Txt[0],
+									TTL: txt.Hdr.Ttl,
+								}
+								if p, ok := provenance.Get(txt.Txt[0]); ok {
+									record.Provenance = &p
+								}
+								result = append(result, record)
+							}
+						}
+					}
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(result)
+					return
+				}
 				if r.Method != "POST" {
-					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+					writeAPIError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
+					return
+				}
+				if !signer.Ready() {
+					writeAPIError(w, r, http.StatusServiceUnavailable, ErrorCodeNotReady, "Zone is not signed yet")
 					return
 				}
 				now := time.Now()
+				if !leases.Allows(r.URL.Query().Get("lease"), now) {
+					writeAPIError(w, r, http.StatusConflict, ErrorCodeLeaseHeld, "Publisher lease is held by another holder")
+					return
+				}
 				defer func() {
 					go func() {
 						time.Sleep(time.Second * 5)
@@ -391,6 +637,17 @@ func main() {
 
 				values := r.URL.Query()
 
+				ttl := opts.RecordTTL
+				if ttlValue := values.Get("ttl"); ttlValue != "" {
+					seconds, err := strconv.ParseUint(ttlValue, 10, 32)
+					if err != nil {
+						writeAPIError(w, r, http.StatusBadRequest, ErrorCodeInvalidTTL, "Invalid ttl")
+						return
+					}
+					// clamp to allowed bounds
+					ttl = min(max(time.Duration(seconds)*time.Second, *apiMinTTL), *apiMaxTTL)
+				}
+
 				var txt []dns.RR
 
 				for _, entry := range values["txt"] {
@@ -402,24 +659,149 @@ func main() {
 							Name:   signer.Zone(),
 							Rrtype: dns.TypeTXT,
 							Class:  dns.ClassINET,
-							Ttl:    TTL(opts.RecordTTL),
+							Ttl:    dnssigner.TTL(ttl),
 						},
 						Txt: []string{entry},
 					})
 				}
 
 				if len(txt) > 0 {
-					signer.Add(txt...)
+					ctx := WithProvenance(r.Context(), RecordProvenance{
+						Source:    RecordSourceAPI,
+						TokenId:   RequestTokenId(r),
+						Remote:    r.RemoteAddr,
+						RequestId: RequestId(r),
+						Time:      now.UTC(),
+					})
+					if err := signer.AddRRSet(ctx, txt...); errors.Is(err, dnssigner.ErrQueueFull) {
+						writeAPIError(w, r, http.StatusServiceUnavailable, ErrorCodeQueueFull, "Signing queue is full")
+						return
+					} else if err != nil {
+						writeAPIError(w, r, http.StatusInternalServerError, ErrorCodeInternal, err.Error())
+						return
+					}
+					if err := auditLog.Write(AuditEvent{
+						Time:      now,
+						Event:     AuditEventPush,
+						RequestId: RequestId(r),
+						Remote:    r.RemoteAddr,
+						TokenId:   RequestTokenId(r),
+					}.WithRecords(txt)); err != nil {
+						slog.Error("Failed to write audit log", "error", err)
+					}
+					slog.Info("Updated TXT records via API", "request_id", RequestId(r), "remote", r.RemoteAddr, "token_id", RequestTokenId(r), "records", len(txt))
 					w.WriteHeader(http.StatusOK)
 				} else {
-					w.WriteHeader(http.StatusBadRequest)
+					writeAPIError(w, r, http.StatusBadRequest, ErrorCodeNoRecords, "No txt records provided")
 				}
-			})); err != nil {
+			})
+
+			if err := http.ListenAndServe(*apiBind, TraceHandler(RequestIdHandler(AuthHandler(*apiToken, mux)))); err != nil {
 				slog.Error("Failed to start HTTP server", "bind", *apiBind, "error", err)
 			}
 		}()
 	}
 
+	signer.AddAuthorityRecords()
+
+	if *state != "" {
+		stateData, from, err := stateSchema.File(*state)
+		if errors.Is(err, migrate.ErrNewerVersion) {
+			// starting empty would overwrite it on the next save
+			slog.Error("State file was written by a newer version, refusing to start", "path", *state, "version", from, "supported", stateSchema.Current())
+			panic(err)
+		} else if err != nil {
+			slog.Warn("Failed to read state file", "error", err)
+		} else {
+			if from < stateSchema.Current() {
+				slog.Info("Migrated state file", "from", from, "to", stateSchema.Current(), "backup", migrate.BackupPath(*state, from))
+			}
+			data, err := ParseState(stateData)
+			if err != nil {
+				slog.Warn("Failed to unpack state file", "error", err)
+			} else {
+				var txt []dns.RR
+				var records []StateRecord
+
+				for _, entry := range data.Records {
+					if len(entry.Txt) == 0 {
+						continue
+					}
+					ttl := entry.TTL
+					if ttl == 0 {
+						ttl = dnssigner.TTL(opts.RecordTTL)
+					}
+					records = append(records, entry)
+					txt = append(txt, &dns.TXT{
+						Hdr: dns.RR_Header{
+							Name:   signer.Zone(),
+							Rrtype: dns.TypeTXT,
+							Class:  dns.ClassINET,
+							Ttl:    ttl,
+						},
+						Txt: []string{entry.Txt},
+					})
+				}
+
+				// restored first, so the change keeps the stored provenance
+				provenance.Restore(records)
+				if err = signer.AddRRSet(context.Background(), txt...); err != nil {
+					provenance.Restore(nil)
+					slog.Warn("Failed to load state file records", "error", err)
+				} else {
+					slog.Info("Loaded state file", "records", len(txt))
+				}
+			}
+		}
+		var stateMutex sync.Mutex
+		var lastTs time.Time
+		storeState = func(ts time.Time) {
+			stateMutex.Lock()
+			defer stateMutex.Unlock()
+
+			// check origin of call
+			if lastTs.After(ts) {
+				return
+			}
+			lastTs = ts
+
+			records := signer.Get(dns.TypeTXT)
+			if records == nil {
+				return
+			}
+			data := State{
+				Version: StateVersion,
+			}
+			for _, rr := range records.RR {
+				if r, ok := rr.(*dns.TXT); ok {
+					p, _ := provenance.Get(r.Txt[0])
+					data.Records = append(data.Records, StateRecord{
+						Txt:        r.Txt[0],
+						TTL:        r.Hdr.Ttl,
+						Provenance: p,
+					})
+				}
+			}
+
+			stateData, err := json.MarshalIndent(data, "", " ")
+			if err != nil {
+				slog.Warn("Failed to encode state", "error", err)
+				return
+			}
+
+			err = atomicfile.WriteFile(*state, stateData, 0644)
+			if err != nil {
+				slog.Warn("Failed to write state file", "error", err)
+				return
+			}
+			slog.Debug("Saved state file")
+		}
+	}
+
+	// load records before answering queries
+	signer.MarkReady()
+	slog.Info("Zone signed, ready to answer queries")
+
 	sendNotify()
 
 	wg.Wait()
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/migrate"
+)
+
+// Sources of TXT records, as stored in RecordProvenance
+const (
+	// RecordSourceAPI Pushed via the HTTP API
+	RecordSourceAPI = "api"
+	// RecordSourceState Loaded from a state file without provenance, written by older versions
+	RecordSourceState = "state"
+)
+
+// RecordProvenance Which source added a TXT record, and when. Kept while later pushes include the same record
+type RecordProvenance struct {
+	Source string `json:"source"`
+	// TokenId Identifies the API token used, without revealing it. Empty if authentication is disabled
+	TokenId   string    `json:"token_id,omitempty"`
+	Remote    string    `json:"remote,omitempty"`
+	RequestId string    `json:"request_id,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// StateVersion Current version of the state file. Version 0 is a plain list of TXT records
+const StateVersion = 1
+
+// stateSchema Migrations of the -state file, applied when loading it
+var stateSchema = migrate.Schema{
+	Name: "state",
+	Steps: []migrate.Step{
+		{
+			Description: "add record provenance",
+			Apply:       migrateStateProvenance,
+		},
+	},
+	Version: func(data []byte) (int, error) {
+		var list []string
+		if json.Unmarshal(data, &list) == nil {
+			return 0, nil
+		}
+		return migrate.ObjectVersion(data)
+	},
+	Indent: " ",
+}
+
+// State Contents of the -state file
+type State struct {
+	Version int           `json:"version"`
+	Records []StateRecord `json:"records"`
+}
+
+type StateRecord struct {
+	Txt string `json:"txt"`
+	// TTL In seconds, as set via the HTTP API. Missing uses -ttl
+	TTL        uint32           `json:"ttl,omitempty"`
+	Provenance RecordProvenance `json:"provenance"`
+}
+
+// migrateStateProvenance Plain lists of records are given provenance from the state file, at the time of migration
+func migrateStateProvenance(data []byte) ([]byte, error) {
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	state := State{
+		Version: 1,
+	}
+	now := time.Now().UTC()
+	for _, txt := range list {
+		state.Records = append(state.Records, StateRecord{
+			Txt: txt,
+			Provenance: RecordProvenance{
+				Source: RecordSourceState,
+				Time:   now,
+			},
+		})
+	}
+	return json.Marshal(state)
+}
+
+// ParseState Decodes a state file, migrating older versions
+func ParseState(data []byte) (state State, err error) {
+	if data, _, err = stateSchema.Migrate(data); err != nil {
+		return State{}, err
+	}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return State{}, err
+	}
+	return state, nil
+}
+
+type provenanceKey struct{}
+
+// WithProvenance Returns ctx carrying p, given to the records it adds once the change is signed
+func WithProvenance(ctx context.Context, p RecordProvenance) context.Context {
+	return context.WithValue(ctx, provenanceKey{}, p)
+}
+
+func ProvenanceFromContext(ctx context.Context) (RecordProvenance, bool) {
+	if ctx == nil {
+		return RecordProvenance{}, false
+	}
+	p, ok := ctx.Value(provenanceKey{}).(RecordProvenance)
+	return p, ok
+}
+
+// ProvenanceTracker Provenance of the current TXT records at the zone apex
+type ProvenanceTracker struct {
+	lock    sync.RWMutex
+	records map[string]RecordProvenance
+}
+
+func NewProvenanceTracker() *ProvenanceTracker {
+	return &ProvenanceTracker{
+		records: make(map[string]RecordProvenance),
+	}
+}
+
+// Replace Sets the current records. Records already present keep their provenance, new ones get p
+func (t *ProvenanceTracker) Replace(records []string, p RecordProvenance) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	next := make(map[string]RecordProvenance, len(records))
+	for _, record := range records {
+		if old, ok := t.records[record]; ok {
+			next[record] = old
+		} else {
+			next[record] = p
+		}
+	}
+	t.records = next
+}
+
+// Restore Sets the current records with their stored provenance
+func (t *ProvenanceTracker) Restore(records []StateRecord) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.records = make(map[string]RecordProvenance, len(records))
+	for _, r := range records {
+		t.records[r.Txt] = r.Provenance
+	}
+}
+
+func (t *ProvenanceTracker) Get(record string) (RecordProvenance, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	p, ok := t.records[record]
+	return p, ok
+}
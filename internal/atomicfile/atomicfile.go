@@ -0,0 +1,68 @@
+// Package atomicfile Writes files via a temporary file in the same directory that is renamed into place,
+// so readers never observe a partially written file, and a crash leaves either the old or the new contents.
+package atomicfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// File operations, replaced in tests to simulate interrupted writes and failures
+var (
+	writeData = func(f *os.File, data []byte) (int, error) {
+		return f.Write(data)
+	}
+	syncFile = func(f *os.File) error {
+		return f.Sync()
+	}
+	rename = os.Rename
+)
+
+// WriteFile Writes data to a temporary file next to filename, syncs it, then renames it into filename.
+// Permissions of an existing filename are preserved, perm is used otherwise.
+// If the target filename already exists but is not a regular file, WriteFile returns an error.
+func WriteFile(filename string, data []byte, perm os.FileMode) (err error) {
+	fi, err := os.Stat(filename)
+	if err == nil {
+		if !fi.Mode().IsRegular() {
+			return fmt.Errorf("%s already exists and is not a regular file", filename)
+		}
+		perm = fi.Mode().Perm()
+	}
+
+	dir := filepath.Dir(filename)
+	f, err := os.CreateTemp(dir, filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpName)
+		}
+	}()
+	if _, err := writeData(f, data); err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if err := syncFile(f); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := rename(tmpName, filename); err != nil {
+		return err
+	}
+
+	// persist the rename itself. Not supported on all platforms, so errors are ignored
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package atomicfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeOld Creates filename with old contents and returns its path
+func writeOld(t *testing.T, perm os.FileMode) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(filename, []byte("old"), perm); err != nil {
+		t.Fatal(err)
+	}
+	// umask may have masked perm
+	if err := os.Chmod(filename, perm); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// checkUnchanged Fails unless filename still has the old contents and is the only file in its directory
+func checkUnchanged(t *testing.T, filename string) {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "old" {
+		t.Errorf("contents = %q, want old", data)
+	}
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != filepath.Base(filename) {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestWriteFileCreates(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+	if err := WriteFile(filename, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new" {
+		t.Errorf("contents = %q, want new", data)
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("perm = %o, want 600", fi.Mode().Perm())
+	}
+}
+
+func TestWriteFileReplaces(t *testing.T) {
+	filename := writeOld(t, 0640)
+	if err := WriteFile(filename, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new" {
+		t.Errorf("contents = %q, want new", data)
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("perm = %o, want existing 640", fi.Mode().Perm())
+	}
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files in directory, want 1", len(entries))
+	}
+}
+
+func TestWriteFileNotRegular(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteFile(dir, []byte("new"), 0600); err == nil {
+		t.Fatal("expected error writing over a directory")
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		t.Errorf("directory was replaced")
+	}
+}
+
+func TestWriteFileFailures(t *testing.T) {
+	errInjected := errors.New("injected")
+
+	tests := []struct {
+		name  string
+		setup func()
+	}{
+		{
+			// a crash or full disk after part of the data was written
+			name: "interrupted write",
+			setup: func() {
+				writeData = func(f *os.File, data []byte) (int, error) {
+					n, _ := f.Write(data[:len(data)/2])
+					return n, errInjected
+				}
+			},
+		},
+		{
+			name: "sync",
+			setup: func() {
+				syncFile = func(f *os.File) error {
+					return errInjected
+				}
+			},
+		},
+		{
+			name: "rename",
+			setup: func() {
+				rename = func(oldpath, newpath string) error {
+					return errInjected
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origWrite, origSync, origRename := writeData, syncFile, rename
+			t.Cleanup(func() {
+				writeData, syncFile, rename = origWrite, origSync, origRename
+			})
+			tt.setup()
+
+			filename := writeOld(t, 0644)
+			if err := WriteFile(filename, []byte("new contents"), 0644); !errors.Is(err, errInjected) {
+				t.Fatalf("err = %v, want injected", err)
+			}
+			checkUnchanged(t, filename)
+		})
+	}
+}
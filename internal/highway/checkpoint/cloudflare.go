@@ -2,6 +2,7 @@ package checkpoint
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
@@ -13,7 +14,43 @@ import (
 	"golang.org/x/net/proxy"
 )
 
-func (cc Config) sendCloudflare(d proxy.ContextDialer, ctx context.Context, c Checkpoints) error {
+func init() {
+	RegisterProvider(MethodCloudflare, newCloudflareProvider)
+}
+
+type cloudflareProvider struct {
+	apiToken string
+	targets  []map[string]string
+}
+
+func newCloudflareProvider(cc Config) (Provider, error) {
+	apiToken, ok := os.LookupEnv("CLOUDFLARE_API_TOKEN")
+	if !ok {
+		apiToken = cc.Config["api-token"]
+	}
+	if apiToken == "" {
+		return nil, fmt.Errorf("api-token or CLOUDFLARE_API_TOKEN environment variable must be set")
+	}
+
+	targets := cc.TargetConfigs()
+	if err := requireKeys(targets, "zone-id", "name", "ttl"); err != nil {
+		return nil, err
+	}
+	if err := requireDurations(targets, "list-timeout", "batch-timeout"); err != nil {
+		return nil, err
+	}
+	for i, target := range targets {
+		if _, err := strconv.Atoi(target["ttl"]); err != nil {
+			return nil, fmt.Errorf("target %d: invalid ttl: %w", i, err)
+		}
+	}
+	return &cloudflareProvider{
+		apiToken: apiToken,
+		targets:  targets,
+	}, nil
+}
+
+func (p *cloudflareProvider) Send(d proxy.ContextDialer, ctx context.Context, publication Publication) error {
 	httpClient := http.Client{
 		Transport: &http.Transport{
 			DialContext: d.DialContext,
@@ -21,26 +58,38 @@ func (cc Config) sendCloudflare(d proxy.ContextDialer, ctx context.Context, c Ch
 		Timeout: 30 * time.Second,
 	}
 
-	apiToken, ok := os.LookupEnv("CLOUDFLARE_API_TOKEN")
-	if !ok {
-		apiToken = cc.Config["api-token"]
-	}
 	client := cloudflare.NewClient(
 		option.WithHTTPClient(&httpClient),
-		option.WithAPIToken(apiToken),
+		option.WithAPIToken(p.apiToken),
 	)
 
-	ttl, err := strconv.Atoi(cc.Config["ttl"])
+	for _, target := range p.targets {
+		if err := pushCloudflare(client, ctx, target, publication); err != nil {
+			return fmt.Errorf("%s: %w", target["name"], err)
+		}
+	}
+	return nil
+}
+
+func pushCloudflare(client *cloudflare.Client, ctx context.Context, config map[string]string, publication Publication) error {
+	ttl, err := strconv.Atoi(config["ttl"])
 	if err != nil {
 		return err
 	}
+	txt, err := publication.Records()
+	if err != nil {
+		return err
+	}
+
+	listCtx, listCancel := phaseContext(ctx, config, "list-timeout")
+	defer listCancel()
 
 	// get old records to remove them
-	records := client.DNS.Records.ListAutoPaging(ctx, dns.RecordListParams{
-		ZoneID: cloudflare.F(cc.Config["zone-id"]),
+	records := client.DNS.Records.ListAutoPaging(listCtx, dns.RecordListParams{
+		ZoneID: cloudflare.F(config["zone-id"]),
 		Match:  cloudflare.F(dns.RecordListParamsMatchAll),
 		Name: cloudflare.F(dns.RecordListParamsName{
-			Exact: cloudflare.F(cc.Config["name"]),
+			Exact: cloudflare.F(config["name"]),
 		}),
 		Type: cloudflare.F(dns.RecordListParamsTypeTXT),
 	})
@@ -51,32 +100,39 @@ func (cc Config) sendCloudflare(d proxy.ContextDialer, ctx context.Context, c Ch
 	for records.Next() {
 		r := records.Current()
 		// sanity check
-		if r.Name != cc.Config["name"] || r.Type != dns.RecordResponseTypeTXT {
+		if r.Name != config["name"] || r.Type != dns.RecordResponseTypeTXT {
 			continue
 		}
 		deletes = append(deletes, dns.RecordBatchParamsDelete{ID: cloudflare.F(r.ID)})
 	}
 
 	if err := records.Err(); err != nil {
-		return err
+		return fmt.Errorf("list records: %w", err)
 	}
+	listCancel()
 
-	for _, r := range c {
+	for _, r := range txt {
 		posts = append(posts, dns.TXTRecordParam{
-			Name:    cloudflare.F(cc.Config["name"]),
+			Name:    cloudflare.F(config["name"]),
 			TTL:     cloudflare.F(dns.TTL(ttl)),
 			Type:    cloudflare.F(dns.TXTRecordTypeTXT),
-			Content: cloudflare.F("\"" + r.String() + "\""),
+			Content: cloudflare.F("\"" + r + "\""),
 			Comment: cloudflare.F("managed by monero-highway"),
 		})
 	}
 
-	_, err = client.DNS.Records.Batch(ctx,
+	batchCtx, batchCancel := phaseContext(ctx, config, "batch-timeout")
+	defer batchCancel()
+
+	_, err = client.DNS.Records.Batch(batchCtx,
 		dns.RecordBatchParams{
-			ZoneID:  cloudflare.F(cc.Config["zone-id"]),
+			ZoneID:  cloudflare.F(config["zone-id"]),
 			Deletes: cloudflare.F(deletes),
 			Posts:   cloudflare.F(posts),
 		},
 	)
-	return err
+	if err != nil {
+		return fmt.Errorf("batch records: %w", err)
+	}
+	return nil
 }
@@ -3,37 +3,155 @@ package checkpoint
 import (
 	"context"
 	"fmt"
+	"maps"
+	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/proxy"
 )
 
+var tracer = otel.Tracer("git.gammaspectra.live/P2Pool/monero-highway/internal/highway/checkpoint")
+
 type Method string
 
+// Built-in methods. Others can be added via RegisterProvider
 const (
 	// MethodHighwayDNS Use cmd/dns-checkpoints api
 	MethodHighwayDNS = "highway-dns"
 	// MethodCloudflare Uses Cloudflare's dns_records batch api
 	MethodCloudflare = "cloudflare"
 	// MethodNjalla Uses Njalla's JSON-RPC API https://njal.la/api/
+	// TODO: not implemented
 	MethodNjalla = "njalla"
 )
 
 type Config struct {
+	// Name Optional identifier of this target, used in logs and state
+	Name   string            `yaml:"name"`
 	Method Method            `yaml:"method"`
 	Config map[string]string `yaml:"config"`
+
+	// Targets Optional per-name config overrides, published in one provider session. Keys not set are taken from Config
+	Targets []map[string]string `yaml:"targets"`
+
+	// Transforms Optional transformations applied in order to the checkpoints before each push
+	Transforms []TransformConfig `yaml:"transforms"`
+
+	// Schedule Optional publish cadence and record limit of this entry
+	Schedule Schedule `yaml:"schedule"`
+}
+
+// Schedule Controls how often and how much is published to an entry. The zero value publishes every checkpoint, unlimited
+type Schedule struct {
+	// Interval Minimum time between publishes. Checkpoints found in between are not pushed, the most recent is once due
+	Interval time.Duration `yaml:"interval"`
+	// MaxRecords Maximum TXT records per publish, metadata included. The lowest checkpoints are dropped to fit
+	MaxRecords int `yaml:"max-records"`
+}
+
+// Limit Trims p to MaxRecords, keeping at least the highest checkpoint
+func (s Schedule) Limit(p Publication) Publication {
+	if s.MaxRecords <= 0 || len(p.Checkpoints)+len(p.Metadata) <= s.MaxRecords {
+		return p
+	}
+	keep := max(1, s.MaxRecords-len(p.Metadata))
+	p.Checkpoints = p.Checkpoints[:min(len(p.Checkpoints), keep)]
+	if extra := len(p.Checkpoints) + len(p.Metadata) - s.MaxRecords; extra > 0 {
+		p.Metadata = p.Metadata[:len(p.Metadata)-extra]
+	}
+	return p
 }
 
-func (cc Config) Send(d proxy.ContextDialer, ctx context.Context, c Checkpoints) error {
-	switch cc.Method {
-	case MethodHighwayDNS:
-		return cc.sendHighway(d, ctx, c)
+// Id Returns the configured name, or one derived from method and index in the list of targets
+func (cc Config) Id(index int) string {
+	if cc.Name != "" {
+		return cc.Name
+	}
+	return fmt.Sprintf("%s#%d", cc.Method, index)
+}
 
-	case MethodCloudflare:
-		return cc.sendCloudflare(d, ctx, c)
-	case MethodNjalla:
-		//TODO
-		fallthrough
-	default:
-		return fmt.Errorf("unknown checkpoint method %s", cc.Method)
+// Validate Checks the provider, transforms and schedule config
+func (cc Config) Validate() error {
+	if cc.Schedule.Interval < 0 {
+		return fmt.Errorf("schedule: interval must not be negative")
+	}
+	if cc.Schedule.MaxRecords < 0 {
+		return fmt.Errorf("schedule: max-records must not be negative")
+	}
+	if _, err := cc.Provider(); err != nil {
+		return err
+	}
+	if _, err := cc.Transformers(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Send Publishes c via the configured method, after applying the configured transforms and record limit.
+// If verify-resolver is set, published records are read back and compared. lease is the publisher lease holder, if any
+func (cc Config) Send(d proxy.ContextDialer, ctx context.Context, c Checkpoints, lease string) (err error) {
+	ctx, span := tracer.Start(ctx, "checkpoint.send", trace.WithAttributes(
+		attribute.String("checkpoint.method", string(cc.Method)),
+		attribute.Int("checkpoint.count", len(c)),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	if len(c) > 0 {
+		span.SetAttributes(attribute.Int64("checkpoint.height", int64(c[0].Height)))
+	}
+
+	p, err := cc.Provider()
+	if err != nil {
+		return err
+	}
+	transforms, err := cc.Transformers()
+	if err != nil {
+		return err
+	}
+
+	publication := Publication{
+		Checkpoints: c,
+		Time:        time.Now(),
+		Lease:       lease,
+	}
+	for _, t := range transforms {
+		publication = t.Transform(publication)
+	}
+	publication = cc.Schedule.Limit(publication)
+	span.SetAttributes(attribute.Int("checkpoint.published", len(publication.Checkpoints)))
+
+	if err = p.Send(d, ctx, publication); err != nil {
+		return err
+	}
+	for _, target := range cc.TargetConfigs() {
+		if target["verify-resolver"] != "" {
+			if err := readBack(d, ctx, target, publication); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// TargetConfigs Returns the effective config for each published name
+func (cc Config) TargetConfigs() []map[string]string {
+	if len(cc.Targets) == 0 {
+		return []map[string]string{cc.Config}
+	}
+	result := make([]map[string]string, 0, len(cc.Targets))
+	for _, t := range cc.Targets {
+		config := make(map[string]string, len(cc.Config)+len(t))
+		maps.Copy(config, cc.Config)
+		maps.Copy(config, t)
+		result = append(result, config)
 	}
+	return result
 }
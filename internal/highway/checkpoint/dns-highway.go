@@ -2,39 +2,114 @@ package checkpoint
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/tracing"
 	"golang.org/x/net/proxy"
 )
 
-func (cc Config) sendHighway(d proxy.ContextDialer, ctx context.Context, c Checkpoints) error {
-	httpClient := http.Client{
+// HighwayError Error returned by cmd/dns-checkpoints api
+type HighwayError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	RequestId  string `json:"request_id"`
+	// Temporary Whether the request can be retried as-is
+	Temporary bool `json:"temporary"`
+}
+
+func (e *HighwayError) Error() string {
+	return fmt.Sprintf("checkpointer returned status code %d: %s (code %s, request id %s)", e.StatusCode, e.Message, e.Code, e.RequestId)
+}
+
+// IsPermanent Reports whether err is a rejection that will not succeed when retried
+func IsPermanent(err error) bool {
+	var highwayErr *HighwayError
+	return errors.As(err, &highwayErr) && !highwayErr.Temporary
+}
+
+func init() {
+	RegisterProvider(MethodHighwayDNS, newHighwayProvider)
+}
+
+type highwayProvider struct {
+	targets []map[string]string
+}
+
+func newHighwayProvider(cc Config) (Provider, error) {
+	targets := cc.TargetConfigs()
+	if err := requireKeys(targets, "url"); err != nil {
+		return nil, err
+	}
+	for i, target := range targets {
+		if _, err := url.Parse(target["url"]); err != nil {
+			return nil, fmt.Errorf("target %d: %w", i, err)
+		}
+		if ttl := target["ttl"]; ttl != "" {
+			if _, err := strconv.ParseUint(ttl, 10, 32); err != nil {
+				return nil, fmt.Errorf("target %d: invalid ttl: %w", i, err)
+			}
+		}
+	}
+	return &highwayProvider{targets: targets}, nil
+}
+
+func (p *highwayProvider) Send(d proxy.ContextDialer, ctx context.Context, publication Publication) error {
+	httpClient := &http.Client{
 		Transport: &http.Transport{
 			DialContext: d.DialContext,
 		},
 		Timeout: 30 * time.Second,
 	}
-	uri, err := url.Parse(cc.Config["url"])
+
+	for _, target := range p.targets {
+		if err := pushHighway(httpClient, ctx, target, publication); err != nil {
+			return fmt.Errorf("%s: %w", target["url"], err)
+		}
+	}
+	return nil
+}
+
+func pushHighway(httpClient *http.Client, ctx context.Context, config map[string]string, publication Publication) error {
+	uri, err := url.Parse(config["url"])
+	if err != nil {
+		return err
+	}
+	records, err := publication.Records()
 	if err != nil {
 		return err
 	}
 	values := uri.Query()
 	delete(values, "txt")
 
-	for _, r := range c {
-		values.Add("txt", r.String())
+	// optional TTL override, clamped by server
+	if ttl, ok := config["ttl"]; ok && ttl != "" {
+		values.Set("ttl", ttl)
+	}
+	if publication.Lease != "" {
+		values.Set("lease", publication.Lease)
+	}
+
+	for _, r := range records {
+		values.Add("txt", r)
 	}
 	uri.RawQuery = values.Encode()
-	req, err := http.NewRequest(http.MethodPost, uri.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri.String(), nil)
 	if err != nil {
 		return err
 	}
 
-	req = req.WithContext(ctx)
+	if token := config["api-token"]; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	tracing.Inject(ctx, req.Header)
 
 	r, err := httpClient.Do(req)
 	if err != nil {
@@ -44,7 +119,19 @@ func (cc Config) sendHighway(d proxy.ContextDialer, ctx context.Context, c Check
 	defer io.ReadAll(r.Body)
 
 	if r.StatusCode != http.StatusOK {
-		return fmt.Errorf("checkpointer returned non-200 status code: %d", r.StatusCode)
+		return highwayResponseError(r)
 	}
 	return nil
 }
+
+// highwayResponseError Decodes the error of a failed cmd/dns-checkpoints api response
+func highwayResponseError(r *http.Response) *HighwayError {
+	highwayErr := &HighwayError{
+		StatusCode: r.StatusCode,
+		Message:    http.StatusText(r.StatusCode),
+		Temporary:  r.StatusCode >= http.StatusInternalServerError || r.StatusCode == http.StatusTooManyRequests,
+	}
+	// older versions do not return structured errors
+	_ = json.NewDecoder(r.Body).Decode(highwayErr)
+	return highwayErr
+}
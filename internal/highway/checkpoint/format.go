@@ -0,0 +1,75 @@
+package checkpoint
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"git.gammaspectra.live/P2Pool/consensus/v4/types"
+)
+
+// maxRecordLength monerod only reads the first character-string of each TXT record
+const maxRecordLength = 255
+
+// Records Encodes c as height:id TXT record strings, in order. These are read as-is by monerod DNS checkpoints,
+// so a zone can be used with --enforce-dns-checkpointing. Each record is checked against a port of the upstream parser
+func (c Checkpoints) Records() (result []string, err error) {
+	// monerod refuses conflicting checkpoints at the same height
+	if err = c.Validate(); err != nil {
+		return nil, err
+	}
+	for _, r := range c {
+		record := r.String()
+		if len(record) > maxRecordLength {
+			return nil, fmt.Errorf("record %s is longer than %d bytes", record, maxRecordLength)
+		}
+		// round-trip, fails if the upstream parser would skip or misread the record
+		parsed, err := ParseMoneroRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("record %s: %w", record, err)
+		}
+		if parsed != r {
+			return nil, fmt.Errorf("record %s parsed as %s", record, parsed)
+		}
+		result = append(result, record)
+	}
+	return result, nil
+}
+
+// ParseMoneroRecord Parses a TXT record the way monerod does in checkpoints::load_checkpoints_from_dns.
+// The height is read via std::stringstream up to the first colon, leading whitespace and trailing garbage included,
+// and the id must be exactly 64 hex characters of either case
+func ParseMoneroRecord(record string) (Checkpoint, error) {
+	heightStr, hashStr, ok := strings.Cut(record, ":")
+	if !ok {
+		return Checkpoint{}, errors.New("missing separator")
+	}
+
+	// operator>> skips leading whitespace, accepts a plus sign, and stops at the first non-digit
+	heightStr = strings.TrimLeft(heightStr, " \t\n\v\f\r")
+	heightStr = strings.TrimPrefix(heightStr, "+")
+	digits := len(heightStr) - len(strings.TrimLeft(heightStr, "0123456789"))
+	if digits == 0 {
+		return Checkpoint{}, errors.New("invalid height")
+	}
+	height, err := strconv.ParseUint(heightStr[:digits], 10, 64)
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("invalid height: %w", err)
+	}
+
+	// epee::string_tools::hex_to_pod
+	if len(hashStr) != types.HashSize*2 {
+		return Checkpoint{}, errors.New("invalid id length")
+	}
+	var id types.Hash
+	if _, err = hex.Decode(id[:], []byte(hashStr)); err != nil {
+		return Checkpoint{}, fmt.Errorf("invalid id: %w", err)
+	}
+
+	return Checkpoint{
+		Height: height,
+		Id:     id,
+	}, nil
+}
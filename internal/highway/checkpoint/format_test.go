@@ -0,0 +1,126 @@
+package checkpoint
+
+import (
+	"strings"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v4/types"
+)
+
+func testHash(b byte) (h types.Hash) {
+	for i := range h {
+		h[i] = b + byte(i)
+	}
+	return h
+}
+
+func TestRecordsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		checkpoints Checkpoints
+	}{
+		{
+			name:        "single",
+			checkpoints: Checkpoints{{Height: 3400000, Id: testHash(0x10)}},
+		},
+		{
+			name: "history",
+			checkpoints: Checkpoints{
+				{Height: 3400100, Id: testHash(0xa0)},
+				{Height: 3400000, Id: testHash(0x10)},
+				{Height: 1, Id: testHash(0xf0)},
+			},
+		},
+		{
+			name:        "zero height",
+			checkpoints: Checkpoints{{Height: 0, Id: testHash(0x01)}},
+		},
+		{
+			name:        "max height",
+			checkpoints: Checkpoints{{Height: ^uint64(0), Id: testHash(0xff)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := tt.checkpoints.Records()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != len(tt.checkpoints) {
+				t.Fatalf("%d records, want %d", len(records), len(tt.checkpoints))
+			}
+			for i, record := range records {
+				if len(record) > maxRecordLength {
+					t.Errorf("record %s is longer than %d bytes", record, maxRecordLength)
+				}
+				parsed, err := ParseMoneroRecord(record)
+				if err != nil {
+					t.Fatalf("record %s: %s", record, err)
+				}
+				if parsed != tt.checkpoints[i] {
+					t.Errorf("record %s parsed as %s, want %s", record, parsed, tt.checkpoints[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecordsConflict(t *testing.T) {
+	// monerod refuses the whole set if two checkpoints share a height
+	c := Checkpoints{
+		{Height: 100, Id: testHash(0x01)},
+		{Height: 100, Id: testHash(0x02)},
+	}
+	if _, err := c.Records(); err == nil {
+		t.Fatal("expected error for conflicting checkpoints")
+	}
+}
+
+func TestParseMoneroRecord(t *testing.T) {
+	id := testHash(0xab)
+	idHex := id.String()
+
+	tests := []struct {
+		record string
+		want   Checkpoint
+		err    bool
+	}{
+		{record: "100:" + idHex, want: Checkpoint{Height: 100, Id: id}},
+		// hex_to_pod accepts either case
+		{record: "100:" + strings.ToUpper(idHex), want: Checkpoint{Height: 100, Id: id}},
+		// operator>> skips leading whitespace and accepts a plus sign
+		{record: " \t100:" + idHex, want: Checkpoint{Height: 100, Id: id}},
+		{record: "+100:" + idHex, want: Checkpoint{Height: 100, Id: id}},
+		// and stops at the first non-digit
+		{record: "100abc:" + idHex, want: Checkpoint{Height: 100, Id: id}},
+		{record: "0100:" + idHex, want: Checkpoint{Height: 100, Id: id}},
+		{record: "100" + idHex, err: true},
+		{record: ":" + idHex, err: true},
+		{record: "-100:" + idHex, err: true},
+		{record: "abc:" + idHex, err: true},
+		{record: "18446744073709551616:" + idHex, err: true},
+		{record: "100:" + idHex[:62], err: true},
+		{record: "100:" + idHex + "00", err: true},
+		{record: "100:" + idHex[:62] + "zz", err: true},
+		{record: "100:" + idHex + " ", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.record, func(t *testing.T) {
+			got, err := ParseMoneroRecord(tt.record)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parsed as %s, expected error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("parsed as %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/tracing"
+	"golang.org/x/net/proxy"
+)
+
+// HighwayLease Publisher lease of a cmd/dns-checkpoints api. While held, only its holder may push records
+type HighwayLease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+	Term    uint64    `json:"term"`
+	// TTL Seconds the lease was granted for, which may be less than requested
+	TTL uint32 `json:"ttl"`
+}
+
+// HighwayRecord A TXT record as listed by a cmd/dns-checkpoints api
+type HighwayRecord struct {
+	Txt string `json:"txt"`
+	TTL uint32 `json:"ttl"`
+}
+
+// HighwayErrorLeaseHeld Error code returned when the lease is held by another holder
+const HighwayErrorLeaseHeld = "lease_held"
+
+// IsLeaseHeld Reports whether err is a rejection because another holder has the publisher lease
+func IsLeaseHeld(err error) bool {
+	var highwayErr *HighwayError
+	return errors.As(err, &highwayErr) && highwayErr.Code == HighwayErrorLeaseHeld
+}
+
+// HighwayClient Calls the lease and records endpoints of a cmd/dns-checkpoints api
+type HighwayClient struct {
+	url   *url.URL
+	token string
+
+	client *http.Client
+}
+
+func NewHighwayClient(d proxy.ContextDialer, apiUrl, token string) (*HighwayClient, error) {
+	uri, err := url.Parse(apiUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &HighwayClient{
+		url:   uri,
+		token: token,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: d.DialContext,
+			},
+			Timeout: 30 * time.Second,
+		},
+	}, nil
+}
+
+// AcquireLease Acquires or renews the publisher lease for holder, for ttl
+func (c *HighwayClient) AcquireLease(ctx context.Context, holder string, ttl time.Duration) (lease HighwayLease, err error) {
+	values := url.Values{}
+	values.Set("holder", holder)
+	values.Set("ttl", strconv.FormatUint(uint64(max(ttl/time.Second, 1)), 10))
+	err = c.do(ctx, http.MethodPost, "lease", values, &lease)
+	return lease, err
+}
+
+// ReleaseLease Gives up the publisher lease, if held by holder
+func (c *HighwayClient) ReleaseLease(ctx context.Context, holder string) error {
+	values := url.Values{}
+	values.Set("holder", holder)
+	return c.do(ctx, http.MethodDelete, "lease", values, nil)
+}
+
+// Records Returns the TXT records currently published at the zone apex
+func (c *HighwayClient) Records(ctx context.Context) (records []HighwayRecord, err error) {
+	err = c.do(ctx, http.MethodGet, "", nil, &records)
+	return records, err
+}
+
+func (c *HighwayClient) do(ctx context.Context, method, path string, values url.Values, result any) error {
+	uri := *c.url
+	uri.Path = strings.TrimSuffix(uri.Path, "/") + "/" + path
+	if values != nil {
+		uri.RawQuery = values.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, uri.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	r, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	defer io.ReadAll(r.Body)
+
+	if r.StatusCode != http.StatusOK {
+		return highwayResponseError(r)
+	}
+	if result != nil {
+		return json.NewDecoder(r.Body).Decode(result)
+	}
+	return nil
+}
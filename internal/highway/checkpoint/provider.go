@@ -0,0 +1,97 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Provider Publishes checkpoints for a validated Config
+type Provider interface {
+	// Send Publishes p to all names of the Config it was created for, in one provider session
+	Send(d proxy.ContextDialer, ctx context.Context, p Publication) error
+}
+
+// ProviderConstructor Validates cc and returns a Provider for it
+type ProviderConstructor func(cc Config) (Provider, error)
+
+var (
+	providersLock sync.RWMutex
+	providers     = make(map[Method]ProviderConstructor)
+)
+
+// RegisterProvider Makes a checkpoint method available to Config. Intended to be called from init.
+// Panics if method is already registered
+func RegisterProvider(method Method, constructor ProviderConstructor) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	if _, ok := providers[method]; ok {
+		panic(fmt.Sprintf("checkpoint method %s already registered", method))
+	}
+	providers[method] = constructor
+}
+
+// Providers Returns the sorted registered checkpoint methods
+func Providers() (methods []Method) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	for method := range providers {
+		methods = append(methods, method)
+	}
+	slices.Sort(methods)
+	return methods
+}
+
+// Provider Returns the Provider for the configured method, validating the config
+func (cc Config) Provider() (Provider, error) {
+	providersLock.RLock()
+	constructor, ok := providers[cc.Method]
+	providersLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown checkpoint method %s", cc.Method)
+	}
+	p, err := constructor(cc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cc.Method, err)
+	}
+	return p, nil
+}
+
+// requireKeys Checks all targets have non-empty values for keys
+func requireKeys(targets []map[string]string, keys ...string) error {
+	for i, target := range targets {
+		for _, k := range keys {
+			if target[k] == "" {
+				return fmt.Errorf("target %d: %s must be set", i, k)
+			}
+		}
+	}
+	return nil
+}
+
+// requireDurations Checks keys, if set on any target, are valid durations
+func requireDurations(targets []map[string]string, keys ...string) error {
+	for i, target := range targets {
+		for _, k := range keys {
+			if v, ok := target[k]; ok {
+				if _, err := time.ParseDuration(v); err != nil {
+					return fmt.Errorf("target %d: invalid %s: %w", i, k, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// phaseContext Returns ctx bounded by the duration in config[key], if set.
+// Used to limit individual steps of multi-step flows, within the overall deadline of ctx
+func phaseContext(ctx context.Context, config map[string]string, key string) (context.Context, context.CancelFunc) {
+	if timeout, err := time.ParseDuration(config[key]); err == nil && timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
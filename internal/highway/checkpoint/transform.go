@@ -0,0 +1,173 @@
+package checkpoint
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Publication Checkpoints and extra records published to a target in one push
+type Publication struct {
+	// Checkpoints Sorted descending by height
+	Checkpoints Checkpoints
+	// Metadata Extra TXT records published after the checkpoints. These must not contain a colon, so monerod skips them
+	Metadata []string
+	// Time When the publication was generated
+	Time time.Time
+	// Lease Publisher lease holder, sent to providers that enforce a lease
+	Lease string
+}
+
+// Records Encodes the checkpoints, followed by the metadata records
+func (p Publication) Records() ([]string, error) {
+	records, err := p.Checkpoints.Records()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range p.Metadata {
+		if strings.Contains(m, ":") {
+			return nil, fmt.Errorf("metadata record %s must not contain a colon", m)
+		}
+		if len(m) > maxRecordLength {
+			return nil, fmt.Errorf("metadata record %s is longer than %d bytes", m, maxRecordLength)
+		}
+		records = append(records, m)
+	}
+	return records, nil
+}
+
+// Transformer Changes the Publication pushed to a target, before it is sent to the provider
+type Transformer interface {
+	Transform(p Publication) Publication
+}
+
+// TransformerConstructor Validates config and returns a Transformer for it
+type TransformerConstructor func(config map[string]string) (Transformer, error)
+
+// TransformConfig A transformation applied to the checkpoint set of a target
+type TransformConfig struct {
+	Type   string            `yaml:"type"`
+	Config map[string]string `yaml:"config"`
+}
+
+// Built-in transform types. Others can be added via RegisterTransformer
+const (
+	// TransformTruncate Keeps the highest count checkpoints
+	TransformTruncate = "truncate"
+	// TransformEpoch Keeps only the lowest checkpoint within each interval of heights
+	TransformEpoch = "epoch"
+	// TransformMetadata Adds a metadata record with the generation time, and optionally an operator id
+	TransformMetadata = "metadata"
+)
+
+var (
+	transformersLock sync.RWMutex
+	transformers     = make(map[string]TransformerConstructor)
+)
+
+// RegisterTransformer Makes a transform type available to Config. Intended to be called from init.
+// Panics if name is already registered
+func RegisterTransformer(name string, constructor TransformerConstructor) {
+	transformersLock.Lock()
+	defer transformersLock.Unlock()
+	if _, ok := transformers[name]; ok {
+		panic(fmt.Sprintf("checkpoint transform %s already registered", name))
+	}
+	transformers[name] = constructor
+}
+
+// Transformers Returns the configured transformers in order, validating their config
+func (cc Config) Transformers() (result []Transformer, err error) {
+	transformersLock.RLock()
+	defer transformersLock.RUnlock()
+	for i, tc := range cc.Transforms {
+		constructor, ok := transformers[tc.Type]
+		if !ok {
+			return nil, fmt.Errorf("transform %d: unknown type %s", i, tc.Type)
+		}
+		t, err := constructor(tc.Config)
+		if err != nil {
+			return nil, fmt.Errorf("transform %d: %s: %w", i, tc.Type, err)
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+func init() {
+	RegisterTransformer(TransformTruncate, newTruncateTransform)
+	RegisterTransformer(TransformEpoch, newEpochTransform)
+	RegisterTransformer(TransformMetadata, newMetadataTransform)
+}
+
+type truncateTransform struct {
+	count int
+}
+
+func newTruncateTransform(config map[string]string) (Transformer, error) {
+	count, err := strconv.Atoi(config["count"])
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("count must be a positive number")
+	}
+	return truncateTransform{count: count}, nil
+}
+
+func (t truncateTransform) Transform(p Publication) Publication {
+	if len(p.Checkpoints) > t.count {
+		p.Checkpoints = p.Checkpoints[:t.count]
+	}
+	return p
+}
+
+type epochTransform struct {
+	interval uint64
+}
+
+func newEpochTransform(config map[string]string) (Transformer, error) {
+	interval, err := strconv.ParseUint(config["interval"], 10, 64)
+	if err != nil || interval == 0 {
+		return nil, fmt.Errorf("interval must be a positive number of blocks")
+	}
+	return epochTransform{interval: interval}, nil
+}
+
+func (t epochTransform) Transform(p Publication) Publication {
+	var result Checkpoints
+	// sorted descending, so the last seen of each epoch is the lowest
+	for _, c := range p.Checkpoints {
+		if len(result) > 0 && result[len(result)-1].Height/t.interval == c.Height/t.interval {
+			result[len(result)-1] = c
+			continue
+		}
+		result = append(result, c)
+	}
+	p.Checkpoints = result
+	return p
+}
+
+// MetadataRecordPrefix Start of records added by the metadata transform
+const MetadataRecordPrefix = "highway-meta"
+
+type metadataTransform struct {
+	operator string
+}
+
+func newMetadataTransform(config map[string]string) (Transformer, error) {
+	operator := config["operator"]
+	if strings.ContainsAny(operator, ": \t\r\n\"") {
+		return nil, fmt.Errorf("operator must not contain colons, quotes or whitespace")
+	}
+	return metadataTransform{operator: operator}, nil
+}
+
+func (t metadataTransform) Transform(p Publication) Publication {
+	record := fmt.Sprintf("%s generated=%d", MetadataRecordPrefix, p.Time.Unix())
+	if t.operator != "" {
+		record += " operator=" + t.operator
+	}
+	p.Metadata = append(slices.Clone(p.Metadata), record)
+	return p
+}
@@ -0,0 +1,107 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/proxy"
+)
+
+// DefaultVerifyTimeout Time to keep retrying read-back when no TTL is configured
+const DefaultVerifyTimeout = time.Minute
+
+const verifyRetryInterval = time.Second * 5
+
+// readBack Resolves the published name via the configured resolver and checks the TXT set matches p.
+// Retries until the TTL window passes, as resolvers might serve the previous set until then
+func readBack(d proxy.ContextDialer, ctx context.Context, config map[string]string, p Publication) error {
+	resolver := config["verify-resolver"]
+	name := config["verify-name"]
+	if name == "" {
+		name = config["name"]
+	}
+	if name == "" {
+		return fmt.Errorf("verify-name must be set to read back records")
+	}
+
+	timeout := DefaultVerifyTimeout
+	if v, ok := config["verify-timeout"]; ok {
+		var err error
+		if timeout, err = time.ParseDuration(v); err != nil {
+			return err
+		}
+	} else if ttl, err := strconv.Atoi(config["ttl"]); err == nil && ttl > 0 {
+		timeout = time.Duration(ttl) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	expected, err := p.Records()
+	if err != nil {
+		return err
+	}
+	slices.Sort(expected)
+
+	for {
+		got, err := resolveTXT(d, ctx, resolver, dns.Fqdn(name))
+		if err == nil {
+			slices.Sort(got)
+			if slices.Equal(expected, got) {
+				return nil
+			}
+			err = fmt.Errorf("read-back of %s mismatch: expected %v, got %v", name, expected, got)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(verifyRetryInterval):
+		}
+	}
+}
+
+// resolveTXT Queries a TXT set over TCP, so it can go through proxy dialers
+func resolveTXT(d proxy.ContextDialer, ctx context.Context, resolver, name string) (result []string, err error) {
+	conn, err := d.DialContext(ctx, "tcp", resolver)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	// unblock reads and writes on cancellation
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	var msg dns.Msg
+	msg.SetQuestion(name, dns.TypeTXT)
+
+	co := &dns.Conn{Conn: conn}
+	if err = co.WriteMsg(&msg); err != nil {
+		return nil, err
+	}
+	resp, err := co.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("resolver returned code %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.EqualFold(txt.Hdr.Name, name) {
+			result = append(result, strings.Join(txt.Txt, ""))
+		}
+	}
+	return result, nil
+}
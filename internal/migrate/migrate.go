@@ -0,0 +1,199 @@
+// Package migrate Upgrades versioned files written by older versions to the current format, one version at a time,
+// so format changes do not require editing files by hand
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"git.gammaspectra.live/P2Pool/monero-highway/internal/atomicfile"
+)
+
+// ErrNewerVersion The file was written by a newer version than the schema knows about
+var ErrNewerVersion = errors.New("written by a newer version")
+
+// Step Converts a document from one version into the next
+type Step struct {
+	// Description Shown when reporting pending migrations
+	Description string
+	Apply       func(data []byte) ([]byte, error)
+}
+
+// Schema Migrations of a persisted file format. Steps[i] upgrades version i to i+1, so the current version is len(Steps)
+type Schema struct {
+	Name  string
+	Steps []Step
+	// Version Detects the version of a document. Default ObjectVersion
+	Version func(data []byte) (int, error)
+	// Indent Used when writing migrated files. Default compact
+	Indent string
+}
+
+// Pending A step that would be applied to a document
+type Pending struct {
+	From        int
+	To          int
+	Description string
+}
+
+// Current Returns the version documents are migrated to
+func (s Schema) Current() int {
+	return len(s.Steps)
+}
+
+func (s Schema) version(data []byte) (int, error) {
+	if s.Version != nil {
+		return s.Version(data)
+	}
+	return ObjectVersion(data)
+}
+
+// Plan Returns the version of data and the steps needed to bring it to the current version.
+// Returns ErrNewerVersion if data is newer than the current version
+func (s Schema) Plan(data []byte) (version int, pending []Pending, err error) {
+	version, err = s.version(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	if version < 0 {
+		return version, nil, fmt.Errorf("%s: invalid version %d", s.Name, version)
+	}
+	if version > s.Current() {
+		return version, nil, fmt.Errorf("%s: version %d is %w, supported %d", s.Name, version, ErrNewerVersion, s.Current())
+	}
+	for v := version; v < s.Current(); v++ {
+		pending = append(pending, Pending{
+			From:        v,
+			To:          v + 1,
+			Description: s.Steps[v].Description,
+		})
+	}
+	return version, pending, nil
+}
+
+// Migrate Applies all pending steps to data, returning the migrated document and the version it had.
+// Documents at the current version are returned unchanged. Documents of newer versions are returned unchanged
+// along with ErrNewerVersion, so callers can decide whether to use them
+func (s Schema) Migrate(data []byte) (result []byte, from int, err error) {
+	from, pending, err := s.Plan(data)
+	if err != nil {
+		if errors.Is(err, ErrNewerVersion) {
+			return data, from, err
+		}
+		return nil, from, err
+	}
+	result = data
+	for _, p := range pending {
+		if result, err = s.Steps[p.From].Apply(result); err != nil {
+			return nil, from, fmt.Errorf("%s: migrating version %d to %d: %w", s.Name, p.From, p.To, err)
+		}
+		// steps must produce the version they claim, or later steps would run on the wrong format
+		if v, err := s.version(result); err != nil {
+			return nil, from, fmt.Errorf("%s: migrating version %d to %d: %w", s.Name, p.From, p.To, err)
+		} else if v != p.To {
+			return nil, from, fmt.Errorf("%s: migrating version %d to %d produced version %d", s.Name, p.From, p.To, v)
+		}
+	}
+	return result, from, nil
+}
+
+// File Reads path and migrates it to the current version. When migrations were applied, the original contents are
+// kept as path.v<version> and the migrated document replaces path. Errors reading path are returned as-is
+func (s Schema) File(path string) (data []byte, from int, err error) {
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, from, err = s.Migrate(original)
+	if err != nil || from == s.Current() {
+		return data, from, err
+	}
+
+	if s.Indent != "" {
+		var buf bytes.Buffer
+		if err = json.Indent(&buf, data, "", s.Indent); err != nil {
+			return nil, from, err
+		}
+		data = buf.Bytes()
+	}
+
+	if err = atomicfile.WriteFile(BackupPath(path, from), original, 0600); err != nil {
+		return nil, from, fmt.Errorf("%s: keeping version %d: %w", s.Name, from, err)
+	}
+	if err = atomicfile.WriteFile(path, data, 0644); err != nil {
+		return nil, from, err
+	}
+	return data, from, nil
+}
+
+// Check Reads path and applies pending migrations in memory, without writing anything
+func (s Schema) Check(path string) (version int, pending []Pending, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	if version, pending, err = s.Plan(data); err != nil {
+		return version, nil, err
+	}
+	if _, _, err = s.Migrate(data); err != nil {
+		return version, pending, err
+	}
+	return version, pending, nil
+}
+
+// Report Logs the version of path and the migrations pending for it, for -check-migrations.
+// Returns false if path cannot be migrated. Missing files are reported and pass, they are created at the current version
+func (s Schema) Report(path string) bool {
+	version, pending, err := s.Check(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Info("File does not exist, nothing to migrate", "file", s.Name, "path", path, "version", s.Current())
+		return true
+	} else if err != nil {
+		slog.Error("File cannot be migrated", "file", s.Name, "path", path, "error", err)
+		return false
+	}
+	if len(pending) == 0 {
+		slog.Info("File is up to date", "file", s.Name, "path", path, "version", version)
+		return true
+	}
+	for _, p := range pending {
+		slog.Info("Pending migration", "file", s.Name, "path", path, "from", p.From, "to", p.To, "description", p.Description)
+	}
+	slog.Info("File will be migrated on startup", "file", s.Name, "path", path, "version", version, "current", s.Current(), "backup", BackupPath(path, version))
+	return true
+}
+
+// BackupPath Where File keeps the contents of path before migrating it from version
+func BackupPath(path string, version int) string {
+	return path + ".v" + strconv.Itoa(version)
+}
+
+// ObjectVersion Reads the version field of a JSON object. Objects without it are version 0
+func ObjectVersion(data []byte) (int, error) {
+	var doc struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return 0, err
+	}
+	return doc.Version, nil
+}
+
+// SetVersion Sets the version field of a JSON object, keeping all other fields
+func SetVersion(data []byte, version int) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("not a JSON object")
+	}
+	fields["version"] = json.RawMessage(strconv.Itoa(version))
+	return json.Marshal(fields)
+}
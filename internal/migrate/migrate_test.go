@@ -0,0 +1,203 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testSchema Renames field a to b in version 1, then adds c in version 2
+var testSchema = Schema{
+	Name: "test",
+	Steps: []Step{
+		{
+			Description: "rename a to b",
+			Apply: func(data []byte) ([]byte, error) {
+				var doc map[string]any
+				if err := json.Unmarshal(data, &doc); err != nil {
+					return nil, err
+				}
+				doc["b"] = doc["a"]
+				delete(doc, "a")
+				data, err := json.Marshal(doc)
+				if err != nil {
+					return nil, err
+				}
+				return SetVersion(data, 1)
+			},
+		},
+		{
+			Description: "add c",
+			Apply: func(data []byte) ([]byte, error) {
+				var doc map[string]any
+				if err := json.Unmarshal(data, &doc); err != nil {
+					return nil, err
+				}
+				doc["c"] = true
+				data, err := json.Marshal(doc)
+				if err != nil {
+					return nil, err
+				}
+				return SetVersion(data, 2)
+			},
+		},
+	},
+	Indent: " ",
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		from int
+		want string
+	}{
+		{name: "from 0", data: `{"a":1}`, from: 0, want: `{"b":1,"c":true,"version":2}`},
+		{name: "from 1", data: `{"b":1,"version":1}`, from: 1, want: `{"b":1,"c":true,"version":2}`},
+		// current documents are returned as-is, not re-encoded
+		{name: "current", data: `{"version":2, "b":1}`, from: 2, want: `{"version":2, "b":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, from, err := testSchema.Migrate([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if from != tt.from {
+				t.Errorf("from = %d, want %d", from, tt.from)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	version, pending, err := testSchema.Plan([]byte(`{"b":1,"version":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("version = %d, want 1", version)
+	}
+	if len(pending) != 1 || pending[0] != (Pending{From: 1, To: 2, Description: "add c"}) {
+		t.Errorf("pending = %+v, want only add c", pending)
+	}
+
+	if _, _, err = testSchema.Plan([]byte(`{"version":-1}`)); err == nil {
+		t.Error("expected error for negative version")
+	}
+}
+
+func TestMigrateWrongStepVersion(t *testing.T) {
+	s := Schema{
+		Name: "test",
+		Steps: []Step{{
+			Description: "forgets to set version",
+			Apply: func(data []byte) ([]byte, error) {
+				return data, nil
+			},
+		}},
+	}
+	if _, _, err := s.Migrate([]byte(`{}`)); err == nil {
+		t.Fatal("expected error for step that does not set its version")
+	}
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	data := []byte(`{"b":1,"version":3}`)
+	got, from, err := testSchema.Migrate(data)
+	if !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("err = %v, want ErrNewerVersion", err)
+	}
+	if from != 3 {
+		t.Errorf("from = %d, want 3", from)
+	}
+	if string(got) != string(data) {
+		t.Errorf("got %s, want unchanged %s", got, data)
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	original := []byte(`{"a":1}`)
+	if err := os.WriteFile(path, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, from, err := testSchema.File(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 0 {
+		t.Errorf("from = %d, want 0", from)
+	}
+	want := "{\n \"b\": 1,\n \"c\": true,\n \"version\": 2\n}"
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != want {
+		t.Errorf("file contains %s, want %s", written, want)
+	}
+
+	backup, err := os.ReadFile(BackupPath(path, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backup) != string(original) {
+		t.Errorf("backup contains %s, want %s", backup, original)
+	}
+
+	// migrated files are left alone on the next read
+	if _, from, err = testSchema.File(path); err != nil {
+		t.Fatal(err)
+	} else if from != testSchema.Current() {
+		t.Errorf("from = %d, want %d", from, testSchema.Current())
+	}
+	if _, err = os.Stat(BackupPath(path, testSchema.Current())); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("backup written for current version, err = %v", err)
+	}
+}
+
+func TestFileNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	original := []byte(`{"b":1,"version":3}`)
+	if err := os.WriteFile(path, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := testSchema.File(path); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("err = %v, want ErrNewerVersion", err)
+	}
+	if _, _, err := testSchema.Check(path); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("Check err = %v, want ErrNewerVersion", err)
+	}
+	if testSchema.Report(path) {
+		t.Error("Report passed a newer version")
+	}
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != string(original) {
+		t.Errorf("file contains %s, want unchanged %s", written, original)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files in directory, want only the state file", len(entries))
+	}
+}
@@ -1,9 +1,18 @@
 package utils
 
 import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/miekg/dns"
 )
 
+// MultiStringFlag Repeatable flag, each value kept as-is
 type MultiStringFlag []string
 
 func (f *MultiStringFlag) String() string {
@@ -14,3 +23,97 @@ func (f *MultiStringFlag) Set(value string) error {
 	*f = append(*f, value)
 	return nil
 }
+
+// ListFlag Repeatable flag that also accepts comma separated values. Empty and duplicate items are dropped.
+// Each item is checked by Validate, if set
+type ListFlag struct {
+	Values   []string
+	Validate func(value string) error
+}
+
+func (f *ListFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.Values, ",")
+}
+
+func (f *ListFlag) Set(value string) error {
+	for item := range strings.SplitSeq(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" || slices.Contains(f.Values, item) {
+			continue
+		}
+		if f.Validate != nil {
+			if err := f.Validate(item); err != nil {
+				return fmt.Errorf("%q: %w", item, err)
+			}
+		}
+		f.Values = append(f.Values, item)
+	}
+	return nil
+}
+
+// MultiDurationFlag Repeatable flag of durations, also accepting comma separated values
+type MultiDurationFlag []time.Duration
+
+func (f *MultiDurationFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	var values []string
+	for _, d := range *f {
+		values = append(values, d.String())
+	}
+	return strings.Join(values, ",")
+}
+
+func (f *MultiDurationFlag) Set(value string) error {
+	for item := range strings.SplitSeq(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		d, err := time.ParseDuration(item)
+		if err != nil {
+			return err
+		}
+		*f = append(*f, d)
+	}
+	return nil
+}
+
+// ValidateHostPort Requires a host:port address with a numeric port
+func ValidateHostPort(value string) error {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// ValidateDomainName Requires a syntactically valid domain name, with or without trailing dot
+func ValidateDomainName(value string) error {
+	if _, ok := dns.IsDomainName(value); !ok {
+		return fmt.Errorf("invalid domain name")
+	}
+	return nil
+}
+
+// ValidateURL Requires an absolute URL with scheme and host
+func ValidateURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("URL must have scheme and host")
+	}
+	return nil
+}
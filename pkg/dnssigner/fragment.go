@@ -0,0 +1,39 @@
+package dnssigner
+
+import "fmt"
+
+// FragmentMode Controls IP fragmentation of UDP responses on a socket, per address family. See RFC 9715
+type FragmentMode string
+
+const (
+	// FragmentDefault Keeps the system behavior
+	FragmentDefault = FragmentMode("")
+	// FragmentOmitPMTU Sends at the interface MTU and ignores ICMP path MTU updates, so spoofed
+	// "fragmentation needed" messages cannot force responses into small fragments
+	FragmentOmitPMTU = FragmentMode("omit-pmtu")
+	// FragmentNever Sets the don't fragment flag, responses larger than the path MTU are dropped instead of fragmented
+	FragmentNever = FragmentMode("never")
+)
+
+// ParseFragmentMode Returns the mode named s. Empty and "default" select FragmentDefault
+func ParseFragmentMode(s string) (FragmentMode, error) {
+	switch FragmentMode(s) {
+	case FragmentDefault, "default":
+		return FragmentDefault, nil
+	case FragmentOmitPMTU, FragmentNever:
+		return FragmentMode(s), nil
+	default:
+		return "", fmt.Errorf("unknown fragment mode %s", s)
+	}
+}
+
+// FragmentPolicy Fragmentation settings for UDP sockets, per address family
+type FragmentPolicy struct {
+	IPv4 FragmentMode
+	IPv6 FragmentMode
+}
+
+// IsDefault Whether no socket options need to be set
+func (p FragmentPolicy) IsDefault() bool {
+	return p.IPv4 == FragmentDefault && p.IPv6 == FragmentDefault
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package dnssigner
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// control Sets the fragmentation socket options of p. IPv6 sockets also carry IPv4-mapped traffic, so both are set there
+func (p FragmentPolicy) control(network, _ string, c syscall.RawConn) error {
+	var err error
+	ctrlErr := c.Control(func(fd uintptr) {
+		switch network {
+		case "udp4":
+			err = setFragmentIPv4(int(fd), p.IPv4)
+		case "udp6":
+			if err = setFragmentIPv6(int(fd), p.IPv6); err != nil {
+				return
+			}
+			// fails on IPV6_V6ONLY sockets, which carry no IPv4 traffic
+			_ = setFragmentIPv4(int(fd), p.IPv4)
+		}
+	})
+	if ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
+
+func setFragmentIPv4(fd int, mode FragmentMode) error {
+	switch mode {
+	case FragmentOmitPMTU:
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_OMIT)
+	case FragmentNever:
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_DO)
+	case FragmentDefault:
+		return nil
+	default:
+		return fmt.Errorf("unknown fragment mode %s", mode)
+	}
+}
+
+func setFragmentIPv6(fd int, mode FragmentMode) error {
+	switch mode {
+	case FragmentOmitPMTU:
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_OMIT)
+	case FragmentNever:
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_DO); err != nil {
+			return err
+		}
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_DONTFRAG, 1)
+	case FragmentDefault:
+		return nil
+	default:
+		return fmt.Errorf("unknown fragment mode %s", mode)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package dnssigner
+
+import (
+	"errors"
+	"syscall"
+)
+
+func (p FragmentPolicy) control(string, string, syscall.RawConn) error {
+	if p.IsDefault() {
+		return nil
+	}
+	return errors.New("fragment modes are not supported on this platform")
+}
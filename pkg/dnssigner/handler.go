@@ -0,0 +1,177 @@
+package dnssigner
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type SignedAnswer struct {
+	RR  []dns.RR
+	Sig *dns.RRSIG
+}
+
+// Zone A source of pre-signed answers for a single zone apex
+type Zone interface {
+	Zone() string
+	ZoneLabels() []string
+	// Snapshot Returns the current zone contents, or nil if not loaded yet. Signed zones must provide a complete NSEC chain,
+	// unsigned zones are answered without proofs
+	Snapshot() *ZoneData
+}
+
+// RequestHandler Answers queries for signer. Queries in the zone are answered with notReady rcode until its Snapshot is available
+func RequestHandler(signer Zone, udp bool, handleAXFR bool, transfers *TransferLimiter, truncation TruncationPolicy, notReady int) dns.HandlerFunc {
+	p := NewReplyPool()
+
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		if len(r.Question) == 0 || r.Opcode != dns.OpcodeQuery {
+			return
+		}
+
+		msg := p.Get()
+		defer p.Put(msg)
+		msg.SetReply(r)
+
+		var data *ZoneData
+		_, span := tracer.Start(context.Background(), "dns.query", trace.WithSpanKind(trace.SpanKindServer))
+		defer func() {
+			// before msg is returned to the pool
+			if span.IsRecording() {
+				traceQuery(span, w, r, msg, data, udp)
+			}
+			span.End()
+		}()
+
+		policy := truncation.For(w.RemoteAddr())
+
+		dns0 := r.IsEdns0()
+		if dns0 != nil {
+			if dns0.Version() != 0 {
+				msg.SetEdns0(policy.AdvertiseSize, false)
+				msg.SetRcode(r, dns.RcodeBadVers)
+				_ = w.WriteMsg(msg)
+				return
+			}
+
+			msg.SetEdns0(policy.AdvertiseSize, dns0.Do())
+		}
+
+		zoneLabels := len(signer.ZoneLabels())
+		dnssec := dns0 != nil && dns0.Do()
+
+		for _, q := range r.Question {
+			if q.Qclass == dns.ClassINET && dns.CompareDomainName(q.Name, signer.Zone()) == zoneLabels {
+				data = signer.Snapshot()
+				if data == nil {
+					msg.SetRcode(r, notReady)
+					break
+				}
+				msg.Authoritative = true
+
+				name := dns.CanonicalName(q.Name)
+				if answer := data.Get(name, q.Qtype); answer != nil {
+					msg.Answer = appendAnswer(msg.Answer, answer, dnssec)
+				} else if (q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR) && name == data.Apex() && handleAXFR && !udp {
+					if q.Qtype == dns.TypeIXFR && len(r.Answer) == 1 {
+						if soa, ok := r.Answer[0].(*dns.SOA); ok {
+							if currentSOA := data.Get(name, dns.TypeSOA); currentSOA == nil || len(currentSOA.RR) == 0 {
+								// abort
+								break
+							} else if cSoa, ok := currentSOA.RR[0].(*dns.SOA); !ok {
+								// abort
+								break
+							} else if cSoa.Serial == soa.Serial {
+								// abort
+								break
+							}
+						}
+					}
+					release, ok := transfers.Acquire(w.RemoteAddr())
+					if !ok {
+						msg.SetRcode(r, dns.RcodeRefused)
+						break
+					}
+					defer release()
+
+					// IXFR is answered with a full AXFR response
+					for _, answer := range data.Transfer() {
+						// always send DNSSEC records here
+						msg.Answer = appendAnswer(msg.Answer, answer, dns0 == nil /* special case for HE */ || dnssec)
+					}
+					if dns0 == nil {
+						// set DO flags
+						msg.SetEdns0(policy.AdvertiseSize, true)
+					}
+				} else if data.Exists(name) {
+					// NODATA, the NSEC at name proves the type does not exist
+					if dnssec {
+						msg.Ns = appendAnswer(msg.Ns, data.Get(data.Apex(), dns.TypeSOA), true)
+						msg.Ns = appendAnswer(msg.Ns, data.Get(name, dns.TypeNSEC), true)
+					}
+				} else if data.HasDescendant(name) {
+					// empty non-terminal, NODATA proven by the NSEC covering it
+					if dnssec {
+						msg.Ns = appendAnswer(msg.Ns, data.Get(data.Apex(), dns.TypeSOA), true)
+						msg.Ns = appendAnswer(msg.Ns, data.Covering(name), true)
+					}
+				} else {
+					// see RFC 4035, Sec 3.1.3
+					covering := data.Covering(name)
+					wildcard := "*." + closestEncloser(data, name)
+
+					if data.Exists(wildcard) {
+						if answer := data.Get(wildcard, q.Qtype); answer != nil && q.Qtype != dns.TypeNSEC {
+							rr, sig := expand(answer, q.Name)
+							msg.Answer = append(msg.Answer, rr...)
+							if dnssec {
+								if sig != nil {
+									msg.Answer = append(msg.Answer, sig)
+								}
+								msg.Ns = appendAnswer(msg.Ns, covering, true)
+							}
+						} else if dnssec {
+							msg.Ns = appendAnswer(msg.Ns, data.Get(data.Apex(), dns.TypeSOA), true)
+							msg.Ns = appendAnswer(msg.Ns, covering, true)
+							if wildcardNSEC := data.Get(wildcard, dns.TypeNSEC); wildcardNSEC != covering {
+								// proves the type does not exist at the wildcard
+								msg.Ns = appendAnswer(msg.Ns, wildcardNSEC, true)
+							}
+						}
+					} else {
+						msg.SetRcode(r, dns.RcodeNameError)
+						if dnssec {
+							msg.Ns = appendAnswer(msg.Ns, data.Get(data.Apex(), dns.TypeSOA), true)
+							msg.Ns = appendAnswer(msg.Ns, covering, true)
+							if wildcardCovering := data.Covering(wildcard); wildcardCovering != covering {
+								// proves no wildcard exists at the closest encloser
+								msg.Ns = appendAnswer(msg.Ns, wildcardCovering, true)
+							}
+						}
+					}
+				}
+			}
+			// disallow multiple queries to same match
+			break
+		}
+
+		if udp {
+			policy.Truncate(msg, dns0)
+		}
+
+		_ = w.WriteMsg(msg)
+	}
+}
+
+// appendAnswer Appends the answer records, and its signature if dnssec is set
+func appendAnswer(rrs []dns.RR, answer *SignedAnswer, dnssec bool) []dns.RR {
+	if answer == nil {
+		return rrs
+	}
+	rrs = append(rrs, answer.RR...)
+	if dnssec && answer.Sig != nil {
+		rrs = append(rrs, answer.Sig)
+	}
+	return rrs
+}
@@ -0,0 +1,175 @@
+package dnssigner
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testWriter Checks responses written by the request handler can be sent as-is
+type testWriter struct {
+	t      *testing.T
+	udp    bool
+	remote net.Addr
+	size   int
+
+	// reply Last response written
+	reply *dns.Msg
+}
+
+func (w *testWriter) LocalAddr() net.Addr {
+	return w.remote
+}
+
+func (w *testWriter) RemoteAddr() net.Addr {
+	return w.remote
+}
+
+func (w *testWriter) WriteMsg(msg *dns.Msg) error {
+	buf, err := msg.Pack()
+	if err != nil {
+		w.t.Fatalf("could not pack response: %s", err)
+	}
+	if w.udp && len(buf) > w.size {
+		w.t.Fatalf("UDP response of %d bytes exceeds size %d", len(buf), w.size)
+	}
+
+	var reply dns.Msg
+	if err = reply.Unpack(buf); err != nil {
+		w.t.Fatalf("could not unpack response: %s", err)
+	}
+	w.reply = &reply
+	return nil
+}
+
+func (w *testWriter) Write(buf []byte) (int, error) {
+	return len(buf), nil
+}
+
+func (w *testWriter) Close() error {
+	return nil
+}
+
+func (w *testWriter) TsigStatus() error {
+	return nil
+}
+
+func (w *testWriter) TsigTimersOnly(bool) {}
+
+func (w *testWriter) Hijack() {}
+
+var testHandlers = sync.OnceValues(func() (udp, tcp dns.HandlerFunc) {
+	opts := DefaultSignerOptions()
+	// fixed key, signatures do not matter here
+	opts.PrivateKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	opts.Nameservers = []string{"ns1.example.com.", "ns2.example.com."}
+	opts.Wildcard = true
+
+	signer, err := NewSigner(slog.New(slog.NewTextHandler(io.Discard, nil)), opts)
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		if err := signer.Process(time.Hour); err != nil {
+			panic(err)
+		}
+	}()
+	signer.AddAuthorityRecords()
+
+	for _, record := range []string{
+		opts.Zone + " 300 IN TXT \"1:0000000000000000000000000000000000000000000000000000000000000000\"",
+		"sub." + opts.Zone + " 300 IN TXT \"subdomain\"",
+		"a.b." + opts.Zone + " 300 IN A 192.0.2.1",
+	} {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			panic(err)
+		}
+		if err = signer.AddRRSet(context.Background(), rr); err != nil {
+			panic(err)
+		}
+	}
+	signer.MarkReady()
+
+	truncation := DefaultTruncationPolicy()
+	truncation.MaxSize = 1232
+	transfers := NewTransferLimiter(1, 0)
+	return RequestHandler(signer, true, true, transfers, truncation, dns.RcodeServerFailure), RequestHandler(signer, false, true, transfers, truncation, dns.RcodeServerFailure)
+})
+
+// fuzzSeed Returns a packed query for name and qtype, with EDNS and the DO bit if do is set
+func fuzzSeed(f *testing.F, name string, qtype uint16, do bool, modify func(msg *dns.Msg)) []byte {
+	var msg dns.Msg
+	msg.SetQuestion(name, qtype)
+	if do {
+		msg.SetEdns0(dns.DefaultMsgSize, true)
+	}
+	if modify != nil {
+		modify(&msg)
+	}
+	buf, err := msg.Pack()
+	if err != nil {
+		f.Fatal(err)
+	}
+	return buf
+}
+
+// FuzzHandler Feeds wire format messages to the request handler over UDP and TCP,
+// failing on panics, responses that cannot be packed, or that do not fit the UDP size
+func FuzzHandler(f *testing.F) {
+	zone := DefaultSignerOptions().Zone
+
+	for _, qtype := range []uint16{dns.TypeTXT, dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY, dns.TypeNSEC, dns.TypeA, dns.TypeANY} {
+		f.Add(fuzzSeed(f, zone, qtype, false, nil))
+		f.Add(fuzzSeed(f, zone, qtype, true, nil))
+	}
+	for _, name := range []string{"sub." + zone, "b." + zone, "a.b." + zone, "missing." + zone, "x.y.sub." + zone, "*." + zone, "example.org."} {
+		f.Add(fuzzSeed(f, name, dns.TypeTXT, true, nil))
+	}
+	f.Add(fuzzSeed(f, zone, dns.TypeAXFR, true, nil))
+	f.Add(fuzzSeed(f, zone, dns.TypeIXFR, false, func(msg *dns.Msg) {
+		soa, _ := dns.NewRR(zone + " 300 IN SOA ns1.example.com. hostmaster.example.com. 1 60 30 600 30")
+		msg.Answer = append(msg.Answer, soa)
+	}))
+	// unsupported EDNS version
+	f.Add(fuzzSeed(f, zone, dns.TypeTXT, true, func(msg *dns.Msg) {
+		msg.IsEdns0().SetVersion(1)
+	}))
+	// small UDP size
+	f.Add(fuzzSeed(f, zone, dns.TypeDNSKEY, true, func(msg *dns.Msg) {
+		msg.IsEdns0().SetUDPSize(dns.MinMsgSize)
+	}))
+	f.Add(fuzzSeed(f, zone, dns.TypeTXT, false, func(msg *dns.Msg) {
+		msg.Question[0].Qclass = dns.ClassCHAOS
+	}))
+	f.Add(fuzzSeed(f, zone, dns.TypeSOA, false, func(msg *dns.Msg) {
+		msg.Opcode = dns.OpcodeNotify
+	}))
+	f.Add(fuzzSeed(f, zone, dns.TypeTXT, true, func(msg *dns.Msg) {
+		msg.Question = append(msg.Question, dns.Question{Name: "sub." + zone, Qtype: dns.TypeTXT, Qclass: dns.ClassINET})
+	}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var r dns.Msg
+		if err := r.Unpack(data); err != nil {
+			t.Skip()
+		}
+
+		udp, tcp := testHandlers()
+
+		size := dns.MinMsgSize
+		if dns0 := r.IsEdns0(); dns0 != nil {
+			size = max(size, min(int(dns0.UDPSize()), 1232))
+		}
+
+		udp(&testWriter{t: t, udp: true, remote: &net.UDPAddr{IP: net.IPv6loopback, Port: 53}, size: size}, r.Copy())
+		tcp(&testWriter{t: t, remote: &net.TCPAddr{IP: net.IPv6loopback, Port: 53}}, r.Copy())
+	})
+}
@@ -1,4 +1,4 @@
-package main
+package dnssigner
 
 import (
 	"sync"
@@ -21,6 +21,8 @@ func NewReplyPool() *ReplyPool {
 
 func (p *ReplyPool) Put(msg *dns.Msg) {
 	// reset
+	msg.MsgHdr = dns.MsgHdr{}
+	msg.Compress = false
 	msg.Question = msg.Question[:0]
 	msg.Answer = msg.Answer[:0]
 	msg.Ns = msg.Ns[:0]
@@ -0,0 +1,254 @@
+package dnssigner
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	resolverQueries   = expvar.NewInt("resolver_queries")
+	resolverRefused   = expvar.NewInt("resolver_refused")
+	resolverForwarded = expvar.NewInt("resolver_forwarded")
+	resolverCacheHits = expvar.NewInt("resolver_cache_hits")
+	resolverMismatch  = expvar.NewInt("resolver_mismatch")
+)
+
+// ResolverMaxCacheTTL Upper bound for caching upstream answers, regardless of their TTL
+const ResolverMaxCacheTTL = time.Hour
+
+// Resolver Answers recursive queries from loopback clients, so a co-located monerod can use it as its DNS server.
+// Queries within the zone are answered from its own data. Queries needed to validate the DNSSEC chain of trust
+// down to the zone (DS / DNSKEY / SOA / NS of its ancestors, and its own DS) are forwarded to an upstream resolver
+// and cached, validation is left to the client. Answers to CD queries were not validated upstream, and are not cached.
+// Everything else is refused
+type Resolver struct {
+	zone     Zone
+	upstream string
+	client   *dns.Client
+
+	lock  sync.Mutex
+	cache map[resolverKey]resolverEntry
+}
+
+type resolverKey struct {
+	name  string
+	qtype uint16
+	do    bool
+	cd    bool
+}
+
+type resolverEntry struct {
+	msg     *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// NewResolver Creates a resolver for zone. upstream is a host:port queried over TCP, empty refuses chain of trust queries
+func NewResolver(zone Zone, upstream string, timeout time.Duration) *Resolver {
+	return &Resolver{
+		zone:     zone,
+		upstream: upstream,
+		client: &dns.Client{
+			Net:     "tcp",
+			Timeout: timeout,
+		},
+		cache: make(map[resolverKey]resolverEntry),
+	}
+}
+
+// Wrap Returns a handler answering recursive queries, passing those within the zone to next. Usable as ServeOptions.Wrap
+func (r *Resolver) Wrap(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		resolverQueries.Add(1)
+		if !isLoopback(w.RemoteAddr()) || len(req.Question) != 1 || req.Opcode != dns.OpcodeQuery {
+			r.refuse(w, req)
+			return
+		}
+
+		q := req.Question[0]
+		if q.Qclass != dns.ClassINET {
+			r.refuse(w, req)
+			return
+		}
+
+		// the DS of the zone is served by its parent
+		apexDS := q.Qtype == dns.TypeDS && dns.CanonicalName(q.Name) == dns.CanonicalName(r.zone.Zone())
+		if dns.IsSubDomain(r.zone.Zone(), q.Name) && !apexDS {
+			next(recursiveWriter{w}, req)
+			return
+		}
+
+		switch q.Qtype {
+		case dns.TypeDS, dns.TypeDNSKEY, dns.TypeSOA, dns.TypeNS:
+			// ancestors of the zone only
+			if r.upstream != "" && dns.IsSubDomain(q.Name, r.zone.Zone()) {
+				r.forward(w, req)
+				return
+			}
+		}
+		r.refuse(w, req)
+	}
+}
+
+func (r *Resolver) refuse(w dns.ResponseWriter, req *dns.Msg) {
+	resolverRefused.Add(1)
+	var msg dns.Msg
+	msg.SetRcode(req, dns.RcodeRefused)
+	msg.RecursionAvailable = true
+	_ = w.WriteMsg(&msg)
+}
+
+func (r *Resolver) forward(w dns.ResponseWriter, req *dns.Msg) {
+	q := req.Question[0]
+	dns0 := req.IsEdns0()
+	key := resolverKey{
+		name:  dns.CanonicalName(q.Name),
+		qtype: q.Qtype,
+		do:    dns0 != nil && dns0.Do(),
+		cd:    req.CheckingDisabled,
+	}
+
+	now := time.Now()
+	msg := r.cached(key, now)
+	if msg == nil {
+		resolverForwarded.Add(1)
+		query := new(dns.Msg)
+		query.SetQuestion(q.Name, q.Qtype)
+		query.CheckingDisabled = key.cd
+		query.SetEdns0(dns.DefaultMsgSize, key.do)
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.client.Timeout)
+		defer cancel()
+		response, _, err := r.client.ExchangeContext(ctx, query, r.upstream)
+		if err == nil && !isResponse(query, response) {
+			resolverMismatch.Add(1)
+			err = errors.New("response does not match query")
+		}
+		if err != nil {
+			var fail dns.Msg
+			fail.SetRcode(req, dns.RcodeServerFailure)
+			fail.RecursionAvailable = true
+			_ = w.WriteMsg(&fail)
+			return
+		}
+		// with CD set upstream did not validate the answer, it may be bogus. Leave those uncached
+		if !key.cd {
+			r.store(key, response, now)
+		}
+		msg = response.Copy()
+	} else {
+		resolverCacheHits.Add(1)
+	}
+
+	msg.Id = req.Id
+	msg.Question = req.Question
+	msg.RecursionDesired = req.RecursionDesired
+	msg.RecursionAvailable = true
+	msg.Authoritative = false
+	if dns0 == nil {
+		msg.Extra = nil
+	}
+	if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+		size := dns.MinMsgSize
+		if dns0 != nil {
+			size = max(size, int(dns0.UDPSize()))
+		}
+		msg.Truncate(size)
+	}
+	_ = w.WriteMsg(msg)
+}
+
+// isResponse Whether response answers query: same id, and a single question with same name, type and class
+func isResponse(query, response *dns.Msg) bool {
+	if !response.Response || response.Id != query.Id || len(response.Question) != 1 {
+		return false
+	}
+	q, a := query.Question[0], response.Question[0]
+	return a.Qtype == q.Qtype && a.Qclass == q.Qclass && dns.CanonicalName(a.Name) == dns.CanonicalName(q.Name)
+}
+
+// cached Returns a copy of the cached answer for key with TTLs reduced by its age, or nil
+func (r *Resolver) cached(key resolverKey, now time.Time) *dns.Msg {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entry, ok := r.cache[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(entry.expires) {
+		delete(r.cache, key)
+		return nil
+	}
+
+	msg := entry.msg.Copy()
+	age := TTL(now.Sub(entry.stored))
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype != dns.TypeOPT {
+				rr.Header().Ttl -= min(age, rr.Header().Ttl)
+			}
+		}
+	}
+	return msg
+}
+
+// store Caches msg for the lowest TTL of its records. Failures and answers without records are not cached
+func (r *Resolver) store(key resolverKey, msg *dns.Msg, now time.Time) {
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return
+	}
+	ttl := TTL(ResolverMaxCacheTTL)
+	found := false
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range section {
+			ttl = min(ttl, rr.Header().Ttl)
+			found = true
+		}
+	}
+	if !found || ttl == 0 {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// prune expired entries
+	for k, entry := range r.cache {
+		if !now.Before(entry.expires) {
+			delete(r.cache, k)
+		}
+	}
+	r.cache[key] = resolverEntry{
+		msg:     msg.Copy(),
+		stored:  now,
+		expires: now.Add(time.Duration(ttl) * time.Second),
+	}
+}
+
+// recursiveWriter Marks authoritative answers as coming from a recursive resolver
+type recursiveWriter struct {
+	dns.ResponseWriter
+}
+
+func (w recursiveWriter) WriteMsg(msg *dns.Msg) error {
+	msg.RecursionAvailable = true
+	msg.Authoritative = false
+	return w.ResponseWriter.WriteMsg(msg)
+}
+
+func isLoopback(addr net.Addr) bool {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.IsLoopback()
+	case *net.TCPAddr:
+		return a.IP.IsLoopback()
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package dnssigner
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testZone A zone without data, the resolver only forwards queries for its ancestors
+type testZone string
+
+func (z testZone) Zone() string {
+	return string(z)
+}
+
+func (z testZone) ZoneLabels() []string {
+	return dns.SplitDomainName(string(z))
+}
+
+func (z testZone) Snapshot() *ZoneData {
+	return nil
+}
+
+// testUpstream Serves DS answers over TCP, answering DNSKEY queries for the wrong name. Returns its address and query counter
+func testUpstream(t *testing.T) (string, *atomic.Int64) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries atomic.Int64
+	server := &dns.Server{
+		Listener: listener,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			queries.Add(1)
+			var msg dns.Msg
+			msg.SetReply(r)
+			if r.Question[0].Qtype == dns.TypeDNSKEY {
+				msg.Question[0].Name = "other.example."
+			}
+			rr, _ := dns.NewRR(r.Question[0].Name + " 300 IN DS 7820 13 2 821887C3654ACCD2DEA3AC14E7E05C9D324B9EFBF26ECBF30047B3DDB4DBF4F3")
+			msg.Answer = append(msg.Answer, rr)
+			_ = w.WriteMsg(&msg)
+		}),
+	}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+	return listener.Addr().String(), &queries
+}
+
+func TestResolverForward(t *testing.T) {
+	upstream, queries := testUpstream(t)
+	handler := NewResolver(testZone("cp.example.com."), upstream, time.Second*5).Wrap(func(w dns.ResponseWriter, r *dns.Msg) {
+		t.Fatal("query passed to zone handler")
+	})
+
+	query := func(qtype uint16, cd bool) *dns.Msg {
+		t.Helper()
+		var r dns.Msg
+		r.SetQuestion("example.com.", qtype)
+		r.CheckingDisabled = cd
+		r.SetEdns0(dns.DefaultMsgSize, true)
+		w := &testWriter{t: t, remote: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}}
+		handler(w, &r)
+		if w.reply == nil {
+			t.Fatal("no response written")
+		}
+		return w.reply
+	}
+
+	tests := []struct {
+		name    string
+		qtype   uint16
+		cd      bool
+		rcode   int
+		queries int64
+	}{
+		{name: "forwarded", qtype: dns.TypeDS, rcode: dns.RcodeSuccess, queries: 1},
+		{name: "cached", qtype: dns.TypeDS, rcode: dns.RcodeSuccess, queries: 1},
+		// not validated upstream, never cached
+		{name: "checking disabled", qtype: dns.TypeDS, cd: true, rcode: dns.RcodeSuccess, queries: 2},
+		{name: "checking disabled again", qtype: dns.TypeDS, cd: true, rcode: dns.RcodeSuccess, queries: 3},
+		{name: "mismatched question", qtype: dns.TypeDNSKEY, rcode: dns.RcodeServerFailure, queries: 4},
+		{name: "mismatched question not cached", qtype: dns.TypeDNSKEY, rcode: dns.RcodeServerFailure, queries: 5},
+	}
+	for _, tt := range tests {
+		reply := query(tt.qtype, tt.cd)
+		if reply.Rcode != tt.rcode {
+			t.Errorf("%s: rcode %s, want %s", tt.name, dns.RcodeToString[reply.Rcode], dns.RcodeToString[tt.rcode])
+		}
+		if tt.rcode == dns.RcodeSuccess && len(reply.Answer) != 1 {
+			t.Errorf("%s: %d answers, want 1", tt.name, len(reply.Answer))
+		}
+		if n := queries.Load(); n != tt.queries {
+			t.Errorf("%s: %d upstream queries, want %d", tt.name, n, tt.queries)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package dnssigner
+
+import (
+	"context"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// ServeOptions Configures the servers started by Serve
+type ServeOptions struct {
+	// AXFR Allow zone transfers over TCP
+	AXFR bool
+	// Transfers Limits zone transfers. Nil allows all
+	Transfers *TransferLimiter
+	// Truncation UDP response sizing
+	Truncation TruncationPolicy
+	// UDPSize Read buffer size for UDP queries
+	UDPSize int
+	// Fragment IP fragmentation of UDP responses, per address family
+	Fragment FragmentPolicy
+	// NotReady Response code for queries before the zone is ready, SERVFAIL or REFUSED
+	NotReady int
+	// Wrap Optional wrapper around the request handler, for example to answer NOTIFY
+	Wrap func(next dns.HandlerFunc) dns.HandlerFunc
+}
+
+func DefaultServeOptions() ServeOptions {
+	return ServeOptions{
+		Truncation: DefaultTruncationPolicy(),
+		UDPSize:    dns.DefaultMsgSize,
+		NotReady:   dns.RcodeServerFailure,
+	}
+}
+
+// Serve Answers queries for zone on addr over UDP and TCP, until ctx is cancelled or either server fails
+func Serve(ctx context.Context, zone Zone, addr string, opts ServeOptions) error {
+	tcpHandler := RequestHandler(zone, false, opts.AXFR, opts.Transfers, opts.Truncation, opts.NotReady)
+	udpHandler := RequestHandler(zone, true, false, nil, opts.Truncation, opts.NotReady)
+	if opts.Wrap != nil {
+		tcpHandler = opts.Wrap(tcpHandler)
+		udpHandler = opts.Wrap(udpHandler)
+	}
+
+	udpServer := &dns.Server{
+		Addr:    addr,
+		Net:     "udp",
+		Handler: udpHandler,
+		UDPSize: opts.UDPSize,
+	}
+	if !opts.Fragment.IsDefault() {
+		// socket options must be set before serving, which ListenAndServe does not allow
+		lc := net.ListenConfig{Control: opts.Fragment.control}
+		conn, err := lc.ListenPacket(ctx, "udp", addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		udpServer.PacketConn = conn
+	}
+
+	servers := []*dns.Server{
+		{
+			Addr:    addr,
+			Net:     "tcp",
+			Handler: tcpHandler,
+		},
+		udpServer,
+	}
+
+	errs := make(chan error, len(servers))
+	var started []*dns.Server
+	defer func() {
+		for _, server := range started {
+			_ = server.ShutdownContext(context.Background())
+		}
+	}()
+
+	for _, server := range servers {
+		listening := make(chan struct{})
+		server.NotifyStartedFunc = func() {
+			close(listening)
+		}
+		go func() {
+			if server.PacketConn != nil {
+				errs <- server.ActivateAndServe()
+				return
+			}
+			errs <- server.ListenAndServe()
+		}()
+
+		// wait for each to listen, so shutdown does not race with startup
+		select {
+		case <-listening:
+			started = append(started, server)
+		case err := <-errs:
+			return err
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errs:
+		return err
+	}
+}
@@ -0,0 +1,865 @@
+package dnssigner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Signer struct {
+	zoneLabels []string
+	opts       SignerOptions
+
+	kskDS dns.DS
+
+	zsk dns.DNSKEY
+	ksk dns.DNSKEY
+
+	ns []*dns.NS
+
+	// apex Canonical zone name, used as key in zone
+	apex string
+	// wildcard Canonical *.zone name
+	wildcard string
+
+	zone          atomic.Pointer[ZoneData]
+	ready         atomic.Bool
+	recordChannel chan rrsetUpdate
+	logger        *slog.Logger
+	onChange      func(change ZoneChange)
+}
+
+// rrsetUpdate Replaces the RRset of rtype at name, or removes it if rr is empty.
+// If resign is set instead, all records are signed again and resign is closed once done
+type rrsetUpdate struct {
+	name   string
+	rtype  uint16
+	rr     []dns.RR
+	resign chan struct{}
+
+	// ctx Context of the caller, used for its values only. Signing is traced as a child of its span
+	ctx    context.Context
+	queued time.Time
+}
+
+// ErrQueueFull Returned when an update could not be queued within SignerOptions.QueueTimeout, as Process is stalled or overloaded
+var ErrQueueFull = errors.New("signer queue is full")
+
+// ZoneChange An RRset that was added, replaced or removed, with the SOA serials around the change
+type ZoneChange struct {
+	Name string
+	Type uint16
+	// RR New RRset, empty on removal
+	RR []dns.RR
+	// Context Context the change was queued with, possibly cancelled already. Carries the values of the caller
+	Context context.Context
+
+	OldSerial uint32
+	NewSerial uint32
+}
+
+const DefaultRecordTTL = time.Minute * 5
+const DefaultSignatureTTL = time.Hour
+const DefaultRefreshTTL = time.Minute
+
+// ClockSkewRange Time of expected clock skew on clients. See RFC 4035, Sec 5.3.1.
+const ClockSkewRange = time.Second * 20
+
+// ClockCheckInterval Interval to check for system clock jumps
+const ClockCheckInterval = time.Second * 5
+
+var (
+	clockJumps       = expvar.NewInt("clock_jumps")
+	lastClockJump    = expvar.NewInt("clock_last_jump_seconds")
+	clockHeld        = expvar.NewInt("clock_held")
+	invalidSignature = expvar.NewInt("signatures_out_of_validity")
+
+	queueLength   = expvar.NewInt("signer_queue_length")
+	queueRejected = expvar.NewInt("signer_queue_rejected")
+)
+
+const DefaultQueueSize = 64
+const DefaultQueueTimeout = time.Second * 5
+
+func TTL(d time.Duration) uint32 {
+	// oh DNS, still using uint32 for time??? at least it's not int32
+	return uint32(d / time.Second)
+}
+
+func DefaultSignerOptions() SignerOptions {
+	return SignerOptions{
+		RecordTTL:         DefaultRecordTTL,
+		AuthorityTTL:      time.Hour * 24,
+		RefreshTTL:        DefaultRefreshTTL,
+		SignatureTTL:      DefaultSignatureTTL,
+		SignatureBackdate: time.Hour * 24,
+		Zone:              "checkpoints.example.com.",
+		Mailbox:           "admin.example.com.",
+
+		FingerprintAlgorithm: dns.SHA256,
+
+		QueueSize:    DefaultQueueSize,
+		QueueTimeout: DefaultQueueTimeout,
+	}
+}
+
+type SignerOptions struct {
+	PrivateKey crypto.Signer
+
+	RecordTTL    time.Duration
+	AuthorityTTL time.Duration
+	RefreshTTL   time.Duration
+
+	SignatureTTL      time.Duration
+	SignatureBackdate time.Duration
+
+	FingerprintAlgorithm uint8
+
+	Zone string
+
+	Mailbox string
+
+	Nameservers []string
+
+	// Wildcard Also answer TXT queries for any name below Zone, via a *.Zone wildcard
+	Wildcard bool
+
+	// QueueSize Number of RRset updates that can wait to be signed by Process
+	QueueSize int
+	// QueueTimeout Time AddRRSet and RemoveRRSet wait for space in a full queue before returning ErrQueueFull.
+	// Zero fails at once, negative waits forever
+	QueueTimeout time.Duration
+}
+
+func (so SignerOptions) PublicKey() (algorithm uint8, pub []byte, err error) {
+	switch t := so.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+
+		if pub, ok := t.Public().(*rsa.PublicKey); ok {
+			buf := exponentToBuf(pub.E)
+			buf = append(buf, pub.N.Bytes()...)
+			return dns.RSASHA256, buf, nil
+		}
+	case ed25519.PrivateKey:
+		algorithm = dns.ED25519
+		if pub, ok := t.Public().(ed25519.PublicKey); ok {
+			// as is bytes
+			return dns.ED25519, pub, nil
+		}
+	case *ecdsa.PrivateKey:
+		var intlen int
+		switch t.Curve {
+		case elliptic.P256():
+			algorithm = dns.ECDSAP256SHA256
+			intlen = 32
+		case elliptic.P384():
+			algorithm = dns.ECDSAP384SHA384
+			intlen = 48
+		default:
+			return 0, nil, fmt.Errorf("unsupported elliptic curve: %s", t.Curve.Params().Name)
+		}
+
+		if pub, ok := t.Public().(*ecdsa.PublicKey); ok {
+			return algorithm, curveToBuf(pub.X, pub.Y, intlen), nil
+		}
+	}
+
+	return 0, nil, fmt.Errorf("unsupported private key type: %T", so.PrivateKey)
+}
+
+func NewSigner(logger *slog.Logger, opts SignerOptions) (*Signer, error) {
+	if len(opts.Nameservers) == 0 {
+		return nil, fmt.Errorf("not enough nameservers specified")
+	}
+	signer := &Signer{
+		opts:          opts,
+		logger:        logger,
+		recordChannel: make(chan rrsetUpdate, max(0, opts.QueueSize)),
+	}
+	signer.zoneLabels = dns.SplitDomainName(opts.Zone)
+	signer.apex = dns.CanonicalName(opts.Zone)
+	signer.wildcard = "*." + signer.apex
+	signer.zone.Store(NewZoneData(signer.apex))
+
+	algorithm, publicKey, err := signer.opts.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	signer.zsk = dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   signer.Zone(),
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+			Ttl:    TTL(signer.opts.AuthorityTTL),
+		},
+		// https://www.rfc-editor.org/rfc/rfc4034.html#section-2.1.1
+		// https://datatracker.ietf.org/doc/html/rfc4035#section-5.3.1
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: algorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+	}
+
+	signer.ksk = dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   signer.Zone(),
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+			Ttl:    TTL(signer.opts.AuthorityTTL),
+		},
+		// https://www.rfc-editor.org/rfc/rfc4034.html#section-2.1.1
+		// https://datatracker.ietf.org/doc/html/rfc4035#section-5.3.1
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: algorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+	}
+
+	zskDS := signer.zsk.ToDS(signer.opts.FingerprintAlgorithm)
+	if zskDS == nil {
+		return nil, fmt.Errorf("failed to generate DS record")
+	}
+
+	kskDS := signer.ksk.ToDS(signer.opts.FingerprintAlgorithm)
+	if kskDS == nil {
+		return nil, fmt.Errorf("failed to generate DS record")
+	}
+
+	signer.kskDS = *kskDS
+
+	for _, n := range signer.opts.Nameservers {
+		signer.ns = append(signer.ns, &dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   signer.Zone(),
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+				Ttl:    TTL(signer.opts.AuthorityTTL),
+			},
+			Ns: n,
+		})
+	}
+
+	return signer, nil
+}
+
+// Process Processes regular signatures with a certain interval cadence. New record updates can be set via the incoming channel
+func (s *Signer) Process(interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	clockTicker := time.NewTicker(ClockCheckInterval)
+	defer clockTicker.Stop()
+	lastClockCheck := time.Now()
+
+	// after a forward clock jump, signing follows the clock from before the jump, advanced by monotonic time,
+	// until Resign accepts the new clock. Signatures made with a clock that is ahead would not be valid yet
+	var held bool
+	// anchor Last clock check without a forward jump, with its monotonic reading
+	anchor := lastClockCheck
+	signTime := func() time.Time {
+		if held {
+			return anchor.Round(0).Add(time.Since(anchor))
+		}
+		return time.Now()
+	}
+
+	var span trace.Span
+	defer func() {
+		if span != nil {
+			span.End()
+		}
+	}()
+
+	for {
+		var done chan struct{}
+		var changed *rrsetUpdate
+		var err error
+		span = nil
+
+		// Process is the only writer, changes are published at once below
+		data := s.zone.Load()
+
+		select {
+		// wait for ticker or a new incoming request
+		case <-ticker.C:
+			_, span = tracer.Start(context.Background(), "dnssigner.sign_all", trace.WithAttributes(attribute.String("dnssigner.reason", "interval")))
+			if data, err = s.signAll(data, signTime()); err != nil {
+				return err
+			}
+		case <-clockTicker.C:
+			now := time.Now()
+			// wall clock elapsed vs monotonic clock elapsed
+			jump := now.Round(0).Sub(lastClockCheck.Round(0)) - now.Sub(lastClockCheck)
+			lastClockCheck = now
+
+			if jump.Abs() >= ClockSkewRange {
+				clockJumps.Add(1)
+				lastClockJump.Set(int64(jump / time.Second))
+			}
+			if jump >= ClockSkewRange {
+				held = true
+				clockHeld.Set(1)
+				s.logger.Error("System clock jumped forward, keeping the previous clock until re-signed", "jump", jump, "clock", signTime())
+			} else if !held {
+				anchor = now
+				if jump <= -ClockSkewRange {
+					s.logger.Error("System clock jumped backward", "jump", jump)
+				}
+			}
+
+			// also refuses signatures made after a forward jump, before it was detected, as their inception is ahead
+			signNow := signTime()
+			if validAt(data, signNow) {
+				// nothing to do
+				continue
+			}
+			invalidSignature.Add(1)
+			s.logger.Error("Signatures outside validity period, re-signing all records", "clock", signNow)
+
+			_, span = tracer.Start(context.Background(), "dnssigner.sign_all", trace.WithAttributes(attribute.String("dnssigner.reason", "clock")))
+			if data, err = s.signAll(data, signNow); err != nil {
+				return err
+			}
+		case update := <-s.recordChannel:
+			queueLength.Set(int64(len(s.recordChannel)))
+			ctx := context.WithoutCancel(update.ctx)
+			if update.resign != nil {
+				_, span = tracer.Start(ctx, "dnssigner.sign_all", trace.WithAttributes(attribute.String("dnssigner.reason", "resign")))
+				done = update.resign
+				if held {
+					s.logger.Warn("Accepting the system clock after a forward jump", "clock", time.Now(), "previous", signTime())
+					held = false
+					clockHeld.Set(0)
+					anchor = time.Now()
+				}
+				if data, err = s.signAll(data, time.Now()); err != nil {
+					return err
+				}
+				break
+			}
+
+			now := signTime()
+			rr := update.rr
+			changed = &update
+
+			_, span = tracer.Start(ctx, "dnssigner.sign", trace.WithAttributes(
+				attribute.String("dns.name", update.name),
+				attribute.String("dns.type", dns.TypeToString[update.rtype]),
+				attribute.Int("dns.records", len(rr)),
+				attribute.Int64("dnssigner.queue_wait_ms", now.Sub(update.queued).Milliseconds()),
+			))
+
+			if len(rr) == 0 {
+				if data.Get(update.name, update.rtype) == nil {
+					// nothing removed
+					span.End()
+					continue
+				}
+				data = data.With(update.name, update.rtype, nil)
+				if s.opts.Wildcard && update.name == s.apex && update.rtype == dns.TypeTXT {
+					data = data.With(s.wildcard, dns.TypeTXT, nil)
+				}
+				// update NSEC chain with type or name removal
+				if data, err = s.updateNSEC(data, now); err != nil {
+					return err
+				}
+				break
+			}
+
+			sig, err := s.sign(rr, now)
+			if err != nil {
+				return err
+			}
+
+			var updateNSEC = data.Get(update.name, update.rtype) == nil
+
+			data = data.With(update.name, update.rtype, &SignedAnswer{
+				RR:  rr,
+				Sig: sig,
+			})
+
+			if s.opts.Wildcard && update.name == s.apex && update.rtype == dns.TypeTXT {
+				updateNSEC = updateNSEC || data.Get(s.wildcard, dns.TypeTXT) == nil
+
+				wildcardRR := make([]dns.RR, 0, len(rr))
+				for _, r := range rr {
+					r = dns.Copy(r)
+					r.Header().Name = s.wildcardName()
+					wildcardRR = append(wildcardRR, r)
+				}
+				wildcardSig, err := s.sign(wildcardRR, now)
+				if err != nil {
+					return err
+				}
+				data = data.With(s.wildcard, dns.TypeTXT, &SignedAnswer{
+					RR:  wildcardRR,
+					Sig: wildcardSig,
+				})
+			}
+
+			// update NSEC chain with type or name existence
+			if updateNSEC {
+				if data, err = s.updateNSEC(data, now); err != nil {
+					return err
+				}
+			}
+		}
+
+		now := signTime()
+		soa := s.SOA(now)
+		sigSOA, err := s.sign([]dns.RR{soa}, now)
+		if err != nil {
+			return err
+		}
+
+		oldSOA := data.Get(s.apex, dns.TypeSOA)
+		data = data.With(s.apex, dns.TypeSOA, &SignedAnswer{
+			RR:  []dns.RR{soa},
+			Sig: sigSOA,
+		})
+		s.zone.Store(data)
+		if span != nil {
+			endSpan(span, soa.Serial)
+			span = nil
+		}
+
+		if changed != nil && s.onChange != nil {
+			change := ZoneChange{
+				Name:      changed.name,
+				Type:      changed.rtype,
+				RR:        changed.rr,
+				Context:   changed.ctx,
+				NewSerial: soa.Serial,
+			}
+			if oldSOA != nil {
+				change.OldSerial = oldSOA.RR[0].(*dns.SOA).Serial
+			}
+			s.onChange(change)
+		}
+
+		if done != nil {
+			close(done)
+		}
+	}
+}
+
+// signAll Signs all existing records
+func (s *Signer) signAll(data *ZoneData, now time.Time) (*ZoneData, error) {
+	next := data
+	for sr := range data.All() {
+		sig, err := s.sign(sr.RR, now)
+		if err != nil {
+			return nil, err
+		}
+		h := sr.RR[0].Header()
+		next = next.With(dns.CanonicalName(h.Name), h.Rrtype, &SignedAnswer{
+			RR:  sr.RR,
+			Sig: sig,
+		})
+	}
+	return next, nil
+}
+
+// validAt Checks that all existing signatures are within their validity period at now
+func validAt(data *ZoneData, now time.Time) bool {
+	for sr := range data.All() {
+		if !sr.Sig.ValidityPeriod(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// OnChange Sets a function called from Process after each RRset change is signed and served. Must be called before Process
+func (s *Signer) OnChange(f func(change ZoneChange)) {
+	s.onChange = f
+}
+
+// Resign Re-signs all records after queued updates are processed, and waits until done.
+// Returns ErrQueueFull like AddRRSet, or the error of ctx if it is done first. Signing still completes then
+func (s *Signer) Resign(ctx context.Context) error {
+	return s.resign(ctx, s.opts.QueueTimeout)
+}
+
+func (s *Signer) resign(ctx context.Context, timeout time.Duration) error {
+	done := make(chan struct{})
+	if err := s.enqueue(rrsetUpdate{resign: done, ctx: ctx}, timeout); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// updateNSEC Rebuilds the NSEC chain across all names in canonical order, wrapping back to the apex.
+// Only NSEC records whose next name or type bitmap changed are signed again. See RFC 4034, Sec 4.1
+func (s *Signer) updateNSEC(data *ZoneData, now time.Time) (*ZoneData, error) {
+	// drop NSEC records of names without any other RRset
+	for _, name := range data.Names() {
+		if types := data.Types(name); len(types) == 1 && types[0] == dns.TypeNSEC {
+			data = data.With(name, dns.TypeNSEC, nil)
+		}
+	}
+
+	names := data.Names()
+	for i, name := range names {
+		// SOA is always set by Process, NSEC and RRSIG exist once this is set
+		types := []uint16{dns.TypeRRSIG, dns.TypeNSEC}
+		if name == s.apex {
+			types = append(types, dns.TypeSOA)
+		}
+		for _, t := range data.Types(name) {
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+		slices.Sort(types)
+
+		nextDomain := data.Owner(names[(i+1)%len(names)])
+
+		if existing := data.Get(name, dns.TypeNSEC); existing != nil {
+			nsec := existing.RR[0].(*dns.NSEC)
+			if nsec.NextDomain == nextDomain && slices.Equal(nsec.TypeBitMap, types) {
+				continue
+			}
+		}
+
+		rr := RR(&dns.NSEC{
+			Hdr: dns.RR_Header{
+				Name:   data.Owner(name),
+				Rrtype: dns.TypeNSEC,
+				Class:  dns.ClassINET,
+				Ttl:    TTL(s.opts.AuthorityTTL),
+			},
+			NextDomain: nextDomain,
+			TypeBitMap: types,
+		})
+
+		sig, err := s.sign(rr, now)
+		if err != nil {
+			return nil, err
+		}
+
+		data = data.With(name, dns.TypeNSEC, &SignedAnswer{
+			RR:  rr,
+			Sig: sig,
+		})
+	}
+	return data, nil
+}
+
+func (s *Signer) ZoneLabels() []string {
+	return s.zoneLabels
+}
+
+func (s *Signer) Zone() string {
+	return s.opts.Zone
+}
+
+func (s *Signer) wildcardName() string {
+	return "*." + s.Zone()
+}
+
+func (s *Signer) Get(rtype uint16) *SignedAnswer {
+	return s.zone.Load().Get(s.apex, rtype)
+}
+
+// Snapshot Returns the current consistent zone contents, or nil until MarkReady is called
+func (s *Signer) Snapshot() *ZoneData {
+	if !s.ready.Load() {
+		return nil
+	}
+	return s.zone.Load()
+}
+
+// MarkReady Waits until all queued records are signed, then starts serving the zone via Snapshot.
+// Process must be running
+func (s *Signer) MarkReady() {
+	_ = s.resign(context.Background(), -1)
+	s.ready.Store(true)
+}
+
+// Ready Whether the zone is fully signed and being served
+func (s *Signer) Ready() bool {
+	return s.ready.Load()
+}
+
+// AddAuthorityRecords Queues the apex DNSKEY, CDS, CDNSKEY and NS records. Waits for queue space regardless of QueueTimeout
+func (s *Signer) AddAuthorityRecords() {
+	//s.add(RR(s.DS())...)
+	_ = s.add(context.Background(), -1, RR(s.DNSKEY()...)...)
+
+	// Add child DS/DNSKEY
+	var cdsRR []*dns.CDS
+	var dnskeyRR []*dns.CDNSKEY
+	for _, dnsKey := range s.DNSKEY() {
+		if dnsKey.Flags&dns.SEP > 0 {
+			dnskeyRR = append(dnskeyRR, dnsKey.ToCDNSKEY())
+			cdsRR = append(cdsRR, dnsKey.ToDS(s.opts.FingerprintAlgorithm).ToCDS())
+		}
+	}
+	_ = s.add(context.Background(), -1, RR(cdsRR...)...)
+	_ = s.add(context.Background(), -1, RR(dnskeyRR...)...)
+
+	_ = s.add(context.Background(), -1, RR(s.NS()...)...)
+}
+
+// AddRRSet Adds or replaces the RRset at its name, at or below the zone apex. All records must share type, name, class and TTL.
+// Returns once the change is queued, it is served after being signed by Process. Returns ErrQueueFull if the queue stays full
+func (s *Signer) AddRRSet(ctx context.Context, rr ...dns.RR) error {
+	if len(rr) == 0 {
+		return errors.New("empty RRset")
+	}
+
+	r0 := rr[0]
+
+	if !dns.IsSubDomain(s.Zone(), r0.Header().Name) {
+		return fmt.Errorf("name %s is not within the zone", r0.Header().Name)
+	}
+	switch r0.Header().Rrtype {
+	case dns.TypeSOA, dns.TypeNSEC, dns.TypeRRSIG:
+		return fmt.Errorf("type %s is managed by the signer", dns.TypeToString[r0.Header().Rrtype])
+	}
+	if s.opts.Wildcard && dns.CanonicalName(r0.Header().Name) == s.wildcard {
+		return fmt.Errorf("name %s is managed by the signer", r0.Header().Name)
+	}
+
+	for _, r := range rr[1:] {
+		if r.Header().Rrtype != r0.Header().Rrtype {
+			return errors.New("rtype mismatch")
+		}
+		if r.Header().Name != r0.Header().Name {
+			return errors.New("name mismatch")
+		}
+		if r.Header().Class != r0.Header().Class {
+			return errors.New("class mismatch")
+		}
+		if r.Header().Ttl != r0.Header().Ttl {
+			return errors.New("ttl mismatch")
+		}
+	}
+
+	return s.add(ctx, s.opts.QueueTimeout, rr...)
+}
+
+// RemoveRRSet Removes the RRset of rtype at name, at or below the zone apex.
+// Authority records (SOA / NS / DNSKEY / NSEC / etc.) cannot be removed from the apex. Returns ErrQueueFull if the queue stays full
+func (s *Signer) RemoveRRSet(ctx context.Context, name string, rtype uint16) error {
+	if !dns.IsSubDomain(s.Zone(), name) {
+		return fmt.Errorf("name %s is not within the zone", name)
+	}
+	name = dns.CanonicalName(name)
+	switch rtype {
+	case dns.TypeNSEC, dns.TypeRRSIG:
+		return fmt.Errorf("type %s is managed by the signer", dns.TypeToString[rtype])
+	case dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY, dns.TypeCDS, dns.TypeCDNSKEY:
+		if name == s.apex {
+			return fmt.Errorf("type %s is managed by the signer", dns.TypeToString[rtype])
+		}
+	}
+	if s.opts.Wildcard && name == s.wildcard {
+		return fmt.Errorf("name %s is managed by the signer", name)
+	}
+
+	if err := s.enqueue(rrsetUpdate{name: name, rtype: rtype, ctx: ctx}, s.opts.QueueTimeout); err != nil {
+		return err
+	}
+	s.logger.Debug("removing records", "name", name, "type", dns.TypeToString[rtype])
+	return nil
+}
+
+func (s *Signer) add(ctx context.Context, timeout time.Duration, rr ...dns.RR) error {
+	if len(rr) == 0 {
+		return nil
+	}
+	err := s.enqueue(rrsetUpdate{
+		name:  dns.CanonicalName(rr[0].Header().Name),
+		rtype: rr[0].Header().Rrtype,
+		rr:    slices.Clone(rr),
+		ctx:   ctx,
+	}, timeout)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rr {
+		s.logger.Debug("adding record", "record", strings.ReplaceAll(r.String(), "\t", " "))
+	}
+	return nil
+}
+
+// enqueue Hands update to Process. When the queue is full, waits up to timeout for space, or forever if negative.
+// Waiting stops early with the error of the update context once it is done
+func (s *Signer) enqueue(update rrsetUpdate, timeout time.Duration) error {
+	update.queued = time.Now()
+	defer func() {
+		queueLength.Set(int64(len(s.recordChannel)))
+	}()
+
+	select {
+	case s.recordChannel <- update:
+		return nil
+	default:
+	}
+
+	if timeout < 0 {
+		select {
+		case s.recordChannel <- update:
+			return nil
+		case <-update.ctx.Done():
+			return update.ctx.Err()
+		}
+	} else if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case s.recordChannel <- update:
+			return nil
+		case <-update.ctx.Done():
+			return update.ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	queueRejected.Add(1)
+	s.logger.Warn("Signer queue is full, update rejected", "name", update.name, "type", dns.TypeToString[update.rtype], "size", cap(s.recordChannel))
+	return ErrQueueFull
+}
+
+func (s *Signer) DNSKEY() []*dns.DNSKEY {
+	return []*dns.DNSKEY{
+		&s.zsk,
+		&s.ksk,
+	}
+}
+
+func (s *Signer) DS() *dns.DS {
+	return &s.kskDS
+}
+
+func RR[T dns.RR](s ...T) (r []dns.RR) {
+	for _, e := range s {
+		r = append(r, e)
+	}
+	return r
+}
+
+func (s *Signer) NS() []*dns.NS {
+	return s.ns
+}
+
+func (s *Signer) SOA(now time.Time) *dns.SOA {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   s.Zone(),
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    TTL(s.opts.AuthorityTTL),
+		},
+		Ns:     s.ns[0].Ns,
+		Mbox:   s.opts.Mailbox,
+		Serial: uint32(now.Unix()),
+
+		Refresh: TTL(s.opts.RefreshTTL),
+		Retry:   TTL(s.opts.RefreshTTL / 2),
+		Expire:  TTL(min(s.opts.RefreshTTL*100, s.opts.AuthorityTTL)),
+		Minttl:  TTL(s.opts.RefreshTTL / 2),
+	}
+}
+
+func (s *Signer) sign(rr []dns.RR, now time.Time) (sig *dns.RRSIG, err error) {
+	var key = &s.zsk
+	switch rr[0].Header().Rrtype {
+	case dns.TypeDNSKEY, dns.TypeCDNSKEY, dns.TypeCDS:
+		key = &s.ksk
+	}
+
+	sigTTL := time.Duration(max(rr[0].Header().Ttl*2, TTL(s.opts.SignatureTTL))) * time.Second
+
+	labels := uint8(dns.CountLabel(rr[0].Header().Name))
+	if strings.HasPrefix(rr[0].Header().Name, "*.") {
+		// wildcard label is not counted, so validators can reconstruct the expanded name. See RFC 4034, Sec 3.1.3
+		labels--
+	}
+
+	sig = &dns.RRSIG{
+		Hdr: dns.RR_Header{
+			Name:   rr[0].Header().Name,
+			Rrtype: dns.TypeRRSIG,
+			Class:  key.Hdr.Class,
+			Ttl:    rr[0].Header().Ttl,
+		},
+		TypeCovered: rr[0].Header().Rrtype,
+		Labels:      labels,
+		OrigTtl:     rr[0].Header().Ttl,
+
+		Expiration: uint32(now.Add(sigTTL + ClockSkewRange).Unix()),
+		Inception:  uint32(now.Add(-s.opts.SignatureBackdate).Unix()),
+		KeyTag:     key.KeyTag(),
+		SignerName: key.Hdr.Name,
+		Algorithm:  key.Algorithm,
+	}
+
+	if err = sig.Sign(s.opts.PrivateKey, rr); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// Set the public key (the values E and N) for RSA
+// RFC 3110: Section 2. RSA Public KEY Resource Records
+func exponentToBuf(_E int) []byte {
+	var buf []byte
+	i := big.NewInt(int64(_E)).Bytes()
+	if len(i) < 256 {
+		buf = make([]byte, 1, 1+len(i))
+		buf[0] = uint8(len(i))
+	} else {
+		buf = make([]byte, 3, 3+len(i))
+		buf[0] = 0
+		buf[1] = uint8(len(i) >> 8)
+		buf[2] = uint8(len(i))
+	}
+	buf = append(buf, i...)
+	return buf
+}
+
+// Set the public key for X and Y for Curve. The two
+// values are just concatenated.
+func curveToBuf(_X, _Y *big.Int, intlen int) []byte {
+	buf := intToBytes(_X, intlen)
+	buf = append(buf, intToBytes(_Y, intlen)...)
+	return buf
+}
+
+// Helper function for packing and unpacking
+func intToBytes(i *big.Int, length int) []byte {
+	buf := i.Bytes()
+	if len(buf) < length {
+		b := make([]byte, length)
+		copy(b[length-len(buf):], buf)
+		return b
+	}
+	return buf
+}
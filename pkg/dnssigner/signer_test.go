@@ -0,0 +1,192 @@
+package dnssigner
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// newTestSigner Creates a signer with a fixed key, without starting Process
+func newTestSigner(t *testing.T, modify func(opts *SignerOptions)) *Signer {
+	opts := DefaultSignerOptions()
+	opts.PrivateKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	opts.Nameservers = []string{"ns1.example.com.", "ns2.example.com."}
+	if modify != nil {
+		modify(&opts)
+	}
+	signer, err := NewSigner(slog.New(slog.NewTextHandler(io.Discard, nil)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestResignContext(t *testing.T) {
+	signer := newTestSigner(t, func(opts *SignerOptions) {
+		opts.QueueSize = 1
+		opts.QueueTimeout = time.Millisecond * 10
+	})
+
+	// Process is not running, so the update is queued but never signed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := signer.Resign(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+
+	if err := signer.Resign(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("err = %v, want ErrQueueFull", err)
+	}
+}
+
+// testSignedZone Signs records in a zone with a wildcard, returning the signer and the served zone
+func testSignedZone(t *testing.T, records []string) (*Signer, *ZoneData) {
+	signer := newTestSigner(t, func(opts *SignerOptions) {
+		opts.Wildcard = true
+	})
+	go func() {
+		if err := signer.Process(time.Hour); err != nil {
+			panic(err)
+		}
+	}()
+	signer.AddAuthorityRecords()
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = signer.AddRRSet(context.Background(), rr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signer.MarkReady()
+	return signer, signer.Snapshot()
+}
+
+// verifySignature Checks sig covers rr and verifies with the matching signer key
+func verifySignature(t *testing.T, signer *Signer, sig *dns.RRSIG, rr []dns.RR) {
+	t.Helper()
+	if sig == nil {
+		t.Fatalf("%s %s is not signed", rr[0].Header().Name, dns.TypeToString[rr[0].Header().Rrtype])
+	}
+	key := signer.DNSKEY()[0]
+	switch sig.TypeCovered {
+	case dns.TypeDNSKEY, dns.TypeCDNSKEY, dns.TypeCDS:
+		key = signer.DNSKEY()[1]
+	}
+	if err := sig.Verify(key, rr); err != nil {
+		t.Errorf("%s %s: %s", rr[0].Header().Name, dns.TypeToString[sig.TypeCovered], err)
+	}
+	if !sig.ValidityPeriod(time.Now()) {
+		t.Errorf("%s %s: signature not valid now", rr[0].Header().Name, dns.TypeToString[sig.TypeCovered])
+	}
+}
+
+func TestNSECChain(t *testing.T) {
+	zone := DefaultSignerOptions().Zone
+	// the names of RFC 4034, Sec 6.1, placed below zone
+	signer, data := testSignedZone(t, []string{
+		zone + " 300 IN TXT \"apex\"",
+		"a." + zone + " 300 IN TXT \"a\"",
+		"yljkjljk.a." + zone + " 300 IN A 192.0.2.1",
+		"Z.a." + zone + " 300 IN TXT \"Z.a\"",
+		"zABC.a." + zone + " 300 IN TXT \"zABC.a\"",
+		"z." + zone + " 300 IN TXT \"z\"",
+		"\\001.z." + zone + " 300 IN TXT \"001.z\"",
+		"*.z." + zone + " 300 IN TXT \"wildcard.z\"",
+		"\\200.z." + zone + " 300 IN TXT \"200.z\"",
+	})
+
+	apexTypes := []uint16{dns.TypeNS, dns.TypeSOA, dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeDNSKEY, dns.TypeCDS, dns.TypeCDNSKEY}
+	slices.Sort(apexTypes)
+	tests := []struct {
+		name  string
+		next  string
+		types []uint16
+	}{
+		{name: zone, next: "*." + zone, types: apexTypes},
+		// added by the signer for Wildcard
+		{name: "*." + zone, next: "a." + zone, types: []uint16{dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC}},
+		{name: "a." + zone, next: "yljkjljk.a." + zone, types: []uint16{dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC}},
+		{name: "yljkjljk.a." + zone, next: "Z.a." + zone, types: []uint16{dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC}},
+		{name: "Z.a." + zone, next: "zABC.a." + zone, types: []uint16{dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC}},
+		{name: "zABC.a." + zone, next: "z." + zone, types: []uint16{dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC}},
+		{name: "z." + zone, next: "\\001.z." + zone, types: []uint16{dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC}},
+		{name: "\\001.z." + zone, next: "*.z." + zone, types: []uint16{dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC}},
+		{name: "*.z." + zone, next: "\\200.z." + zone, types: []uint16{dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC}},
+		// wraps back to the apex
+		{name: "\\200.z." + zone, next: zone, types: []uint16{dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC}},
+	}
+
+	names := data.Names()
+	if len(names) != len(tests) {
+		t.Fatalf("zone has names %v, want %d", names, len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if names[i] != dns.CanonicalName(tt.name) {
+				t.Fatalf("name %d is %s, want %s", i, names[i], dns.CanonicalName(tt.name))
+			}
+			answer := data.Get(names[i], dns.TypeNSEC)
+			if answer == nil {
+				t.Fatal("missing NSEC")
+			}
+			nsec := answer.RR[0].(*dns.NSEC)
+			if nsec.NextDomain != tt.next {
+				t.Errorf("next name %s, want %s", nsec.NextDomain, tt.next)
+			}
+			slices.Sort(tt.types)
+			if !slices.Equal(nsec.TypeBitMap, tt.types) {
+				t.Errorf("types %v, want %v", nsec.TypeBitMap, tt.types)
+			}
+			verifySignature(t, signer, answer.Sig, answer.RR)
+		})
+	}
+
+	for sr := range data.All() {
+		verifySignature(t, signer, sr.Sig, sr.RR)
+	}
+}
+
+func TestWildcardSignature(t *testing.T) {
+	zone := DefaultSignerOptions().Zone
+	signer, data := testSignedZone(t, []string{
+		zone + " 300 IN TXT \"apex\"",
+		"*.z." + zone + " 300 IN TXT \"wildcard.z\"",
+	})
+
+	tests := []struct {
+		wildcard string
+		name     string
+	}{
+		{wildcard: "*." + zone, name: "missing." + zone},
+		{wildcard: "*." + zone, name: "a.b.c." + zone},
+		{wildcard: "*.z." + zone, name: "missing.z." + zone},
+		{wildcard: "*.z." + zone, name: "a.b.z." + zone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer := data.Get(tt.wildcard, dns.TypeTXT)
+			if answer == nil {
+				t.Fatal("missing wildcard TXT")
+			}
+			// the asterisk label is not counted. See RFC 4034, Sec 3.1.3
+			if want := uint8(dns.CountLabel(tt.wildcard) - 1); answer.Sig.Labels != want {
+				t.Fatalf("labels %d, want %d", answer.Sig.Labels, want)
+			}
+			verifySignature(t, signer, answer.Sig, answer.RR)
+
+			// validators reconstruct the wildcard owner from the expanded name and labels
+			rr, sig := expand(answer, tt.name)
+			verifySignature(t, signer, sig, rr)
+		})
+	}
+}
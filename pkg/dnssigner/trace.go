@@ -0,0 +1,45 @@
+package dnssigner
+
+import (
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer Creates spans for queries and signing. A no-op unless a tracer provider is installed, see internal/tracing
+var tracer = otel.Tracer("git.gammaspectra.live/P2Pool/monero-highway/pkg/dnssigner")
+
+// endSpan Sets the zone serial the span resulted in, and ends it
+func endSpan(span trace.Span, serial uint32) {
+	if span.IsRecording() {
+		span.SetAttributes(attribute.Int64("dns.serial", int64(serial)))
+	}
+	span.End()
+}
+
+// traceQuery Sets attributes of the query span from the request and its reply. data may be nil
+func traceQuery(span trace.Span, w dns.ResponseWriter, r, msg *dns.Msg, data *ZoneData, udp bool) {
+	q := r.Question[0]
+	transport := "tcp"
+	if udp {
+		transport = "udp"
+	}
+	span.SetAttributes(
+		attribute.String("dns.question.name", q.Name),
+		attribute.String("dns.question.type", dns.TypeToString[q.Qtype]),
+		attribute.String("dns.rcode", dns.RcodeToString[msg.Rcode]),
+		attribute.Bool("dns.truncated", msg.Truncated),
+		attribute.Int("dns.answers", len(msg.Answer)),
+		attribute.String("network.transport", transport),
+		attribute.String("client.address", w.RemoteAddr().String()),
+	)
+	if data == nil {
+		return
+	}
+	if soa := data.Get(data.Apex(), dns.TypeSOA); soa != nil && len(soa.RR) > 0 {
+		if soa, ok := soa.RR[0].(*dns.SOA); ok {
+			span.SetAttributes(attribute.Int64("dns.serial", int64(soa.Serial)))
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package dnssigner
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// TransferLimiter Caps concurrent zone transfers and paces repeated transfers from the same client address
+type TransferLimiter struct {
+	slots    chan struct{}
+	interval time.Duration
+
+	lock sync.Mutex
+	last map[netip.Addr]time.Time
+}
+
+func NewTransferLimiter(concurrency int, interval time.Duration) *TransferLimiter {
+	return &TransferLimiter{
+		slots:    make(chan struct{}, max(1, concurrency)),
+		interval: interval,
+		last:     make(map[netip.Addr]time.Time),
+	}
+}
+
+// Acquire Reserves a transfer slot for addr. If ok, release must be called once the transfer has been written
+func (l *TransferLimiter) Acquire(addr net.Addr) (release func(), ok bool) {
+	if l == nil {
+		return func() {}, true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		return nil, false
+	}
+	release = func() {
+		<-l.slots
+	}
+
+	if l.interval > 0 {
+		var ip netip.Addr
+		if tcpAddr, isTCP := addr.(*net.TCPAddr); isTCP {
+			ip, _ = netip.AddrFromSlice(tcpAddr.IP)
+			ip = ip.Unmap()
+		}
+
+		if !func() bool {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+
+			now := time.Now()
+			if t, ok := l.last[ip]; ok && now.Sub(t) < l.interval {
+				return false
+			}
+			// only transfers that got a slot count towards the interval
+			l.last[ip] = now
+
+			// prune old entries
+			for k, t := range l.last {
+				if now.Sub(t) >= l.interval {
+					delete(l.last, k)
+				}
+			}
+			return true
+		}() {
+			release()
+			return nil, false
+		}
+	}
+
+	return release, true
+}
@@ -0,0 +1,38 @@
+package dnssigner
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTransferLimiter(t *testing.T) {
+	l := NewTransferLimiter(1, time.Hour)
+	a := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+	b := &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 1000}
+
+	release, ok := l.Acquire(a)
+	if !ok {
+		t.Fatal("first transfer refused")
+	}
+	if _, ok = l.Acquire(b); ok {
+		t.Fatal("transfer allowed over concurrency limit")
+	}
+	release()
+
+	// refused for lack of a slot, so its interval has not started
+	releaseB, ok := l.Acquire(b)
+	if !ok {
+		t.Fatal("transfer refused after a slot was freed")
+	}
+	releaseB()
+
+	if _, ok = l.Acquire(a); ok {
+		t.Fatal("transfer allowed within interval")
+	}
+	// refused by interval, must not hold a slot
+	if release, ok = l.Acquire(&net.TCPAddr{IP: net.ParseIP("192.0.2.3"), Port: 1000}); !ok {
+		t.Fatal("slot leaked by refused transfer")
+	}
+	release()
+}
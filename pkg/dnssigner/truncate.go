@@ -0,0 +1,113 @@
+package dnssigner
+
+import (
+	"net"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// TruncationPolicy Controls how UDP responses are sized and truncated.
+// Smaller responses avoid IP fragmentation, at the cost of more clients falling back to TCP
+type TruncationPolicy struct {
+	// MaxSize Largest UDP response to send, even if the client advertises a larger size. Zero uses the client size
+	MaxSize uint16
+	// AdvertiseSize EDNS UDP size advertised on responses
+	AdvertiseSize uint16
+	// Minimal Drops additional, then authority records before setting TC, so answers that fit on their own are not truncated.
+	// Dropping DNSSEC proofs from the authority section always sets TC
+	Minimal bool
+	// KeepAuthority Keeps authority records (SOA / NSEC) that still fit in truncated responses
+	KeepAuthority bool
+
+	// IPv4 Sizes for clients over IPv4, including IPv4-mapped addresses
+	IPv4 FamilySize
+	// IPv6 Sizes for clients over IPv6. Its minimum MTU of 1280 leaves 1232 bytes for DNS, see RFC 9715
+	IPv6 FamilySize
+}
+
+// FamilySize Overrides MaxSize and AdvertiseSize for one address family. Zero values keep the shared setting
+type FamilySize struct {
+	MaxSize       uint16
+	AdvertiseSize uint16
+}
+
+// For Returns the policy to use for a client at addr, with its address family sizes applied
+func (p TruncationPolicy) For(addr net.Addr) TruncationPolicy {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		return p
+	}
+
+	family := p.IPv6
+	if ip.To4() != nil {
+		family = p.IPv4
+	}
+	if family.MaxSize > 0 {
+		p.MaxSize = family.MaxSize
+	}
+	if family.AdvertiseSize > 0 {
+		p.AdvertiseSize = family.AdvertiseSize
+	}
+	return p
+}
+
+func DefaultTruncationPolicy() TruncationPolicy {
+	return TruncationPolicy{
+		AdvertiseSize: dns.DefaultMsgSize,
+		KeepAuthority: true,
+	}
+}
+
+// size Returns the maximum UDP response size for a request with the given OPT record, if any
+func (p TruncationPolicy) size(dns0 *dns.OPT) int {
+	size := dns.MinMsgSize
+	if dns0 != nil {
+		size = max(size, int(dns0.UDPSize()))
+	}
+	if p.MaxSize > 0 {
+		size = max(dns.MinMsgSize, min(size, int(p.MaxSize)))
+	}
+	return size
+}
+
+// Truncate Fits msg within the UDP response size for the request
+func (p TruncationPolicy) Truncate(msg *dns.Msg, dns0 *dns.OPT) {
+	size := p.size(dns0)
+	if msg.Len() <= size {
+		return
+	}
+
+	if p.Minimal {
+		msg.Extra = slices.DeleteFunc(msg.Extra, func(rr dns.RR) bool {
+			return rr.Header().Rrtype != dns.TypeOPT
+		})
+		if msg.Len() > size {
+			// negative and wildcard answers cannot be validated without their proofs, have the client retry over TCP
+			if slices.ContainsFunc(msg.Ns, isProof) {
+				msg.Truncated = true
+			}
+			msg.Ns = msg.Ns[:0]
+		}
+	}
+
+	msg.Truncate(size)
+
+	if msg.Truncated && !p.KeepAuthority {
+		msg.Ns = msg.Ns[:0]
+	}
+}
+
+// isProof Whether rr is part of a DNSSEC proof in the authority section
+func isProof(rr dns.RR) bool {
+	switch rr.Header().Rrtype {
+	case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+		return true
+	}
+	return false
+}
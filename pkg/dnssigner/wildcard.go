@@ -0,0 +1,31 @@
+package dnssigner
+
+import "github.com/miekg/dns"
+
+// closestEncloser Returns the longest existing ancestor of name, which must be at or below the zone apex. See RFC 4592, Sec 3.3.1
+func closestEncloser(data *ZoneData, name string) string {
+	for {
+		if name == data.Apex() || data.Exists(name) || data.HasDescendant(name) {
+			return name
+		}
+		i, end := dns.NextLabel(name, 0)
+		if end {
+			return data.Apex()
+		}
+		name = name[i:]
+	}
+}
+
+// expand Returns a copy of the wildcard answer with owner name set to name
+func expand(answer *SignedAnswer, name string) (result []dns.RR, sig *dns.RRSIG) {
+	for _, rr := range answer.RR {
+		rr = dns.Copy(rr)
+		rr.Header().Name = name
+		result = append(result, rr)
+	}
+	if answer.Sig != nil {
+		sig = dns.Copy(answer.Sig).(*dns.RRSIG)
+		sig.Hdr.Name = name
+	}
+	return result, sig
+}
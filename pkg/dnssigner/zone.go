@@ -0,0 +1,196 @@
+package dnssigner
+
+import (
+	"bytes"
+	"iter"
+	"maps"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+type rrsetKey struct {
+	name  string
+	rtype uint16
+}
+
+// ZoneData Immutable set of signed RRsets keyed by owner name and type.
+// Updates return a modified copy, so readers and zone transfers always see a consistent snapshot.
+// Owner names are expected in canonical form, see dns.CanonicalName
+type ZoneData struct {
+	apex string
+
+	sets map[rrsetKey]*SignedAnswer
+	// names Owner names in canonical order
+	names []string
+	// types Sorted types of each owner name
+	types map[string][]uint16
+}
+
+func NewZoneData(apex string) *ZoneData {
+	return &ZoneData{
+		apex:  dns.CanonicalName(apex),
+		sets:  make(map[rrsetKey]*SignedAnswer),
+		types: make(map[string][]uint16),
+	}
+}
+
+// Apex Returns the canonical zone apex name
+func (z *ZoneData) Apex() string {
+	return z.apex
+}
+
+func (z *ZoneData) Get(name string, rtype uint16) *SignedAnswer {
+	return z.sets[rrsetKey{name: name, rtype: rtype}]
+}
+
+// Names Returns owner names in canonical order. Must not be modified
+func (z *ZoneData) Names() []string {
+	return z.names
+}
+
+// Types Returns the sorted types existing at name. Must not be modified
+func (z *ZoneData) Types(name string) []uint16 {
+	return z.types[name]
+}
+
+// All Iterates all RRsets in canonical order, by owner name then type
+func (z *ZoneData) All() iter.Seq[*SignedAnswer] {
+	return func(yield func(*SignedAnswer) bool) {
+		for _, name := range z.names {
+			for _, t := range z.types[name] {
+				if !yield(z.sets[rrsetKey{name: name, rtype: t}]) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// With Returns a copy with the RRset of rtype at name replaced by answer, or removed if answer is nil
+func (z *ZoneData) With(name string, rtype uint16, answer *SignedAnswer) *ZoneData {
+	next := &ZoneData{
+		apex:  z.apex,
+		sets:  maps.Clone(z.sets),
+		names: z.names,
+		types: maps.Clone(z.types),
+	}
+	key := rrsetKey{name: name, rtype: rtype}
+	types := z.types[name]
+
+	if answer == nil {
+		if _, ok := z.sets[key]; !ok {
+			return z
+		}
+		delete(next.sets, key)
+		types = slices.DeleteFunc(slices.Clone(types), func(t uint16) bool {
+			return t == rtype
+		})
+		if len(types) == 0 {
+			delete(next.types, name)
+			next.names = slices.DeleteFunc(slices.Clone(z.names), func(n string) bool {
+				return n == name
+			})
+		} else {
+			next.types[name] = types
+		}
+		return next
+	}
+
+	next.sets[key] = answer
+	if i, found := slices.BinarySearch(types, rtype); !found {
+		next.types[name] = slices.Insert(slices.Clone(types), i, rtype)
+	}
+	if i, found := slices.BinarySearchFunc(z.names, name, CompareCanonical); !found {
+		next.names = slices.Insert(slices.Clone(z.names), i, name)
+	}
+	return next
+}
+
+// Exists Whether name owns any RRset
+func (z *ZoneData) Exists(name string) bool {
+	return len(z.types[name]) > 0
+}
+
+// HasDescendant Whether any owner name is below name. Names without RRsets but with descendants are empty non-terminals
+func (z *ZoneData) HasDescendant(name string) bool {
+	// descendants directly follow their ancestor in canonical order
+	i, found := slices.BinarySearchFunc(z.names, name, CompareCanonical)
+	if found {
+		i++
+	}
+	return i < len(z.names) && dns.IsSubDomain(name, z.names[i])
+}
+
+// Covering Returns the NSEC RRset matching name, or the one whose owner precedes name in canonical order
+func (z *ZoneData) Covering(name string) *SignedAnswer {
+	i, found := slices.BinarySearchFunc(z.names, name, CompareCanonical)
+	if !found {
+		if i == 0 {
+			// before apex, wraps around
+			i = len(z.names)
+		}
+		i--
+	}
+	if i < 0 || i >= len(z.names) {
+		return nil
+	}
+	return z.Get(z.names[i], dns.TypeNSEC)
+}
+
+// Owner Returns the owner name of name as set on its records, preserving case
+func (z *ZoneData) Owner(name string) string {
+	if types := z.types[name]; len(types) > 0 {
+		return z.sets[rrsetKey{name: name, rtype: types[0]}].RR[0].Header().Name
+	}
+	return name
+}
+
+// Transfer Returns the zone contents in AXFR order, starting with a signed SOA and ending with an unsigned SOA.
+// Empty if there is no SOA
+func (z *ZoneData) Transfer() (result []*SignedAnswer) {
+	soa := z.Get(z.apex, dns.TypeSOA)
+	if soa == nil {
+		return nil
+	}
+	// first signed, last unsigned
+	result = append(result, soa)
+	for sr := range z.All() {
+		if sr != soa {
+			result = append(result, sr)
+		}
+	}
+	result = append(result, &SignedAnswer{
+		RR: soa.RR,
+	})
+	return result
+}
+
+// canonicalLabels Returns the lowercased wire labels of name, leftmost first
+func canonicalLabels(name string) (labels [][]byte, err error) {
+	buf := make([]byte, 256)
+	off, err := dns.PackDomainName(name, buf, 0, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < off && buf[i] != 0; i += int(buf[i]) + 1 {
+		labels = append(labels, bytes.ToLower(buf[i+1:i+1+int(buf[i])]))
+	}
+	return labels, nil
+}
+
+// CompareCanonical Compares two domain names in DNSSEC canonical order. See RFC 4034, Sec 6.1
+func CompareCanonical(a, b string) int {
+	la, errA := canonicalLabels(a)
+	lb, errB := canonicalLabels(b)
+	if errA != nil || errB != nil {
+		// invalid names, keep a stable order
+		return bytes.Compare([]byte(dns.CanonicalName(a)), []byte(dns.CanonicalName(b)))
+	}
+	for i := 1; i <= min(len(la), len(lb)); i++ {
+		if c := bytes.Compare(la[len(la)-i], lb[len(lb)-i]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}